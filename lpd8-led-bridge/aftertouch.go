@@ -0,0 +1,90 @@
+package main
+
+// Aftertouch brightening (aftertouch: true): pressure on a held pad lifts
+// its rendered color toward full brightness, and letting go (pressure 0 or
+// the Note Off) drops it back. Only the rendered color changes, never
+// padState. Polyphonic aftertouch names its pad; channel aftertouch applies
+// to the pad most recently pressed on that source and still held.
+
+// Set from config
+var aftertouchEnabled bool
+
+// Guarded by stateMutex
+var (
+	padPressure = make(map[uint8]uint8)  // Pad note -> current pressure (absent = none)
+	lastHeldPad = make(map[string]uint8) // Source -> most recent held pad
+)
+
+// Remember a pad press for channel aftertouch from its source
+func aftertouchPress(source string, note uint8) {
+	if !aftertouchEnabled {
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	lastHeldPad[source] = note
+}
+
+// Drop a released pad's pressure
+func aftertouchRelease(source string, note uint8) {
+	if !aftertouchEnabled {
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if held, ok := lastHeldPad[source]; ok && held == note {
+		delete(lastHeldPad, source)
+	}
+	if _, ok := padPressure[note]; ok {
+		delete(padPressure, note)
+		queueSend()
+	}
+}
+
+// Handle channel aftertouch from a source
+func handleChannelPressure(source string, pressure uint8) {
+	handlePressureScene(pressure)
+	if !aftertouchEnabled {
+		return
+	}
+	stateMutex.Lock()
+	note, ok := lastHeldPad[source]
+	stateMutex.Unlock()
+	if ok {
+		handlePadPressure(note, pressure)
+	}
+}
+
+// Handle aftertouch for one pad (0 = released)
+func handlePadPressure(note uint8, pressure uint8) {
+	if !aftertouchEnabled {
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if _, ok := noteToPayloadPos[note]; !ok || padPressure[note] == pressure {
+		return
+	}
+	if pressure == 0 {
+		delete(padPressure, note)
+	} else {
+		padPressure[note] = pressure
+	}
+	debugLog("Aftertouch: pad %d pressure %d", note, pressure)
+	queueSend()
+}
+
+// Lift a lit color toward full brightness by pressure (127 = brightest
+// channel at 127); off stays off
+func pressureColor(c Color, pressure uint8) Color {
+	peak := max(c.R, c.G, c.B)
+	if peak == 0 {
+		return c
+	}
+	target := float64(peak) + float64(127-peak)*float64(pressure)/127
+	scale := target / float64(peak)
+	lift := func(v byte) byte { return byte(min(float64(v)*scale+0.5, 127)) }
+	return Color{R: lift(c.R), G: lift(c.G), B: lift(c.B)}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+// Auto-off (auto_off_ms): a pad pressed on turns itself off again after a
+// while unless it's pressed first, so a shared device drifts back to a
+// clean state. Timing out acts like pressing the pad off, so an amber's
+// blues follow it as they would for a real press.
+
+// Time before a pressed-on pad turns off, set from config (0 = never)
+var autoOffDelay time.Duration
+
+// Pending auto-off timers by pad (guarded by stateMutex)
+var autoOffTimers = make(map[uint8]*time.Timer)
+
+// Restart a pad's auto-off timer after a press: cancel any pending one,
+// and schedule a new one if the pad is now on
+// Caller must hold stateMutex
+func resetAutoOffLocked(note uint8) {
+	if t, ok := autoOffTimers[note]; ok {
+		t.Stop()
+		delete(autoOffTimers, note)
+	}
+	if autoOffDelay <= 0 || !padState[note] {
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(autoOffDelay, func() {
+		stateMutex.Lock()
+		defer stateMutex.Unlock()
+
+		// Cancelled or replaced while this one was firing
+		if autoOffTimers[note] != t {
+			return
+		}
+		delete(autoOffTimers, note)
+		if !padState[note] {
+			return
+		}
+
+		debugLog("Pad %d auto-off after %v", note, autoOffDelay)
+		if _, isAmber := amberToBlues[note]; isAmber {
+			handleAmberPressLocked(ledOut, note, 127)
+		} else {
+			handleBluePressLocked(ledOut, note, 127)
+		}
+	})
+	autoOffTimers[note] = t
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Blinking pads: while on, pads in blinkPads alternate between their color
+// and off, each at its own rate (blink_rates, else blink_ms) with its own
+// phase. padState and padColors are untouched - renderColors blanks them
+// during the off phase, so a pad turned off stops blinking immediately and
+// keeps its brightness when it comes back.
+// With -clock-sync, incoming MIDI clock flips every blinking pad on the beat
+// instead (see setClockBlink), and the timer takes over again if the clock
+// stops.
+//
+// Split pads (split_pads) ride on the same goroutine: while on, they swap
+// between their two colors every splitInterval, fast enough to read as a
+// blend of the two. Like blinking, this only happens in renderColors.
+
+// Default blink half-period (blink_ms = 0)
+const defaultBlinkInterval = 500 * time.Millisecond
+
+// Longest the blinker sleeps, so pads added by a reload start promptly
+const blinkMaxWait = 100 * time.Millisecond
+
+// Blinking pads and their half-period, set from config
+var blinkPads = map[uint8]time.Duration{}
+
+// How long a split pad shows each of its two colors
+const splitInterval = 20 * time.Millisecond
+
+// Split pads and their two colors, set from config
+var splitPads = map[uint8][2]Color{}
+
+// Which of the two colors split pads show, and when they next swap
+// (guarded by stateMutex)
+var (
+	splitPhase int
+	splitNext  time.Time
+)
+
+// Per-pad blink phase (guarded by stateMutex): whether the pad is in the off
+// half, and when it next flips
+var (
+	blinkPhaseOff = map[uint8]bool{}
+	blinkNext     = map[uint8]time.Time{}
+)
+
+// Start the blink goroutine, running until ctx is done; the returned
+// function waits for it to stop
+func startBlinker(ctx context.Context) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			stateMutex.Lock()
+			wait := nextBlinkLocked(time.Now())
+			stateMutex.Unlock()
+
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+
+			// Every pad due now flips in the same frame
+			now := time.Now()
+			clockBlink := clockDrivesBlink()
+			stateMutex.Lock()
+			changed := advanceSplitLocked(now)
+			if !clockBlink && advanceBlinkLocked(now) {
+				changed = true
+			}
+			if changed {
+				queueSend()
+			}
+			stateMutex.Unlock()
+		}
+	}()
+
+	return func() {
+		<-done
+
+		// Leave blinking pads lit for the final frame
+		stateMutex.Lock()
+		blinkPhaseOff = make(map[uint8]bool)
+		splitPhase = 0
+		queueSend()
+		stateMutex.Unlock()
+	}
+}
+
+// How long until the next pad flips, at most blinkMaxWait
+// Caller must hold stateMutex
+func nextBlinkLocked(now time.Time) time.Duration {
+	wait := blinkMaxWait
+	for note := range blinkPads {
+		next, ok := blinkNext[note]
+		if !ok {
+			return 0 // New pad, schedule it now
+		}
+		wait = min(wait, next.Sub(now))
+	}
+	if len(splitPads) > 0 {
+		wait = min(wait, splitNext.Sub(now))
+	}
+	return max(wait, 0)
+}
+
+// Swap the split pads' colors if their interval is up; returns true if
+// they swapped
+// Caller must hold stateMutex
+func advanceSplitLocked(now time.Time) bool {
+	if len(splitPads) == 0 || now.Before(splitNext) {
+		return false
+	}
+	splitPhase = 1 - splitPhase
+	splitNext = now.Add(splitInterval)
+	return true
+}
+
+// Flip every pad whose half-period is up; returns true if any flipped.
+// A pad without a schedule starts in its on half.
+// Caller must hold stateMutex
+func advanceBlinkLocked(now time.Time) bool {
+	changed := false
+	for note, half := range blinkPads {
+		next, ok := blinkNext[note]
+		if !ok {
+			blinkNext[note] = now.Add(half)
+			continue
+		}
+		if now.Before(next) {
+			continue
+		}
+		blinkPhaseOff[note] = !blinkPhaseOff[note]
+		next = next.Add(half)
+		if next.Before(now) {
+			next = now.Add(half) // Fell behind, e.g. while the clock had the blink
+		}
+		blinkNext[note] = next
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// Per-channel color themes (channel_colors): a pad pressed from a MIDI
+// channel with a theme color lights in that color, e.g. one color for each
+// deck's channel. The channel that last pressed each pad is remembered, so
+// it keeps the color of the deck that drives it. Knob-picked and pad_colors
+// colors still come first.
+
+var channelColors = map[uint8]Color{} // MIDI channel (0-15) -> on color
+var padChannel = map[uint8]uint8{}    // Pad note -> channel (0-15) that last pressed it (guarded by stateMutex)
+
+// Rebuild channelColors from config, clamping channels to 0-127
+// Caller must hold stateMutex
+func buildChannelColors(cfg Config) {
+	channelColors = make(map[uint8]Color)
+	for chStr, c := range cfg.ChannelColors {
+		var ch int
+		fmt.Sscanf(chStr, "%d", &ch)
+		channelColors[uint8(ch-1)] = Color{R: min(c.R, 127), G: min(c.G, 127), B: min(c.B, 127)}
+	}
+}
+
+// Remember the channel a pad press came in on; call before the press is
+// processed so it lights in that channel's color
+func notePadChannel(note uint8, ch uint8) {
+	if len(channelColors) == 0 {
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	padChannel[note] = ch
+}
+
+// The theme color of the channel that last pressed a pad, if it has one
+// Caller must hold stateMutex
+func channelColor(note uint8) (Color, bool) {
+	ch, ok := padChannel[note]
+	if !ok {
+		return Color{}, false
+	}
+	c, ok := channelColors[ch]
+	return c, ok
+}
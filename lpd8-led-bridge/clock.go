@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// MIDI clock runs at 24 pulses per quarter note
+const clockPPQN = 24
+
+// If no clock pulse arrives for this long, clock is considered stopped
+const clockTimeout = 500 * time.Millisecond
+
+// With -clock-sync, blinking falls back to blink_ms after this long without
+// clock
+const clockSyncTimeout = 2 * time.Second
+
+// Clock indicator pad (0 = disabled), set from config
+var clockIndicatorNote uint8
+
+// Lock blinking to the beat of incoming MIDI clock (-clock-sync)
+var clockSync bool
+
+var (
+	clockMutex     sync.Mutex
+	clockTicks     int         // Pulses since the last quarter note
+	clockTimer     *time.Timer // Fires when clock stops arriving
+	clockLastPulse time.Time   // When the last pulse arrived
+	clockInterval  float64     // Smoothed seconds between pulses (0 = unknown)
+	clockLoggedBPM int         // Last BPM written to the debug log
+)
+
+// Handle an incoming MIDI timing clock pulse
+func handleClockTick() {
+	if clockIndicatorNote == 0 && !clockSync {
+		return
+	}
+
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+
+	now := time.Now()
+
+	// Restart the dropout timer on every pulse
+	if clockTimer == nil {
+		clockTimer = time.AfterFunc(clockTimeout, clockStopped)
+		clockTicks = 0
+		clockInterval = 0
+	} else {
+		clockTimer.Reset(clockTimeout)
+		updateClockTempo(now.Sub(clockLastPulse).Seconds())
+	}
+	clockLastPulse = now
+
+	// Pulse on for the first half of each quarter note, off for the second
+	switch clockTicks {
+	case 0:
+		logClockTempo()
+		setClockIndicator(true)
+		setClockBlink(false)
+	case clockPPQN / 2:
+		setClockIndicator(false)
+		setClockBlink(true)
+	}
+	clockTicks = (clockTicks + 1) % clockPPQN
+}
+
+// Smooth the pulse spacing so single late pulses don't swing the tempo
+// (caller holds clockMutex)
+func updateClockTempo(gap float64) {
+	if clockInterval == 0 {
+		clockInterval = gap
+		return
+	}
+	clockInterval += (gap - clockInterval) * 0.1
+}
+
+// Current tempo from the pulse spacing (0 = unknown; caller holds clockMutex)
+func clockBPM() float64 {
+	if clockInterval <= 0 {
+		return 0
+	}
+	return 60 / (clockInterval * clockPPQN)
+}
+
+// Debug-log the tempo when it changes by a whole BPM (caller holds clockMutex)
+func logClockTempo() {
+	bpm := int(math.Round(clockBPM()))
+	if bpm != 0 && bpm != clockLoggedBPM {
+		clockLoggedBPM = bpm
+		debugLog("MIDI clock: %d BPM", bpm)
+	}
+}
+
+// Whether clock is driving the blink (-clock-sync and a recent pulse, or
+// a tapped tempo)
+func clockDrivesBlink() bool {
+	if !clockSync {
+		return false
+	}
+	if tapTempoRunning() {
+		return true
+	}
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	return !clockLastPulse.IsZero() && time.Since(clockLastPulse) < clockSyncTimeout
+}
+
+// Whether MIDI clock pulses are arriving
+func midiClockRunning() bool {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	return clockTimer != nil
+}
+
+// Clock dropped out - take the indicator dark
+func clockStopped() {
+	mappingsMutex.RLock()
+	defer mappingsMutex.RUnlock()
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+
+	clockTimer = nil
+	clockLoggedBPM = 0
+	debugLog("MIDI clock stopped")
+	setClockIndicator(false)
+}
+
+// Set the clock indicator pad to a soft version of its row color, or off
+func setClockIndicator(on bool) {
+	if clockIndicatorNote == 0 {
+		return
+	}
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pos, ok := noteToPayloadPos[clockIndicatorNote]
+	if !ok {
+		return
+	}
+
+	color := colorOff
+	if on {
+		base := onColor(clockIndicatorNote)
+		color = Color{R: base.R / 3, G: base.G / 3, B: base.B / 3}
+	}
+	if padColors[pos] == color {
+		return
+	}
+	padState[clockIndicatorNote] = on
+	padColors[pos] = color
+
+	queueSend()
+}
+
+// Put blinking pads in the on or off half of the blink, on the beat
+func setClockBlink(off bool) {
+	if !clockSync {
+		return
+	}
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	changed := false
+	for note := range blinkPads {
+		if blinkPhaseOff[note] != off {
+			blinkPhaseOff[note] = off
+			changed = true
+		}
+		delete(blinkNext, note) // The timer restarts from here if the clock stops
+	}
+	if changed {
+		queueSend()
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	"lpd8-led-bridge/pkg/lpd8"
+)
+
+// Amber color cycles (amber_to_color_cycle): instead of controlling blues,
+// each press of such an amber steps the blue above it (same column) to the
+// next color in its list, wrapping around. An off (0,0,0) entry turns the
+// blue off. The amber is lit while the blue shows a color.
+
+// Runtime mappings (rebuilt from config); guarded by stateMutex
+var (
+	amberColorCycle  = map[uint8][]Color{} // Amber note -> colors to step through
+	amberCycleTarget = map[uint8]uint8{}   // Amber note -> blue above it
+	amberCycleIndex  = map[uint8]int{}     // Amber note -> current color (-1 = not started)
+)
+
+// Rebuild the color cycles; the target is the top row pad in the same
+// column, and cycles whose target is reserved are dropped
+func buildColorCycles(cfg Config) {
+	amberColorCycle = make(map[uint8][]Color)
+	amberCycleTarget = make(map[uint8]uint8)
+	amberCycleIndex = make(map[uint8]int)
+	for noteStr, colors := range cfg.AmberToColorCycle {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		col := -1
+		for i, amber := range cfg.LPD8.BottomRow {
+			if amber == note {
+				col = i
+			}
+		}
+		if col < 0 || len(colors) == 0 || reservedPads[uint8(cfg.LPD8.TopRow[col])] {
+			continue
+		}
+		cycle := make([]Color, len(colors))
+		for i, c := range colors {
+			cycle[i] = Color{R: min(c.R, 127), G: min(c.G, 127), B: min(c.B, 127)}
+		}
+		amberColorCycle[uint8(note)] = cycle
+		amberCycleTarget[uint8(note)] = uint8(cfg.LPD8.TopRow[col])
+		amberCycleIndex[uint8(note)] = -1
+	}
+}
+
+// Handle a press of a color cycle amber: step its blue to the next color
+// in a single SysEx
+// vel scales the amber's on-color (127 = full brightness)
+func handleAmberCyclePress(amberNote uint8, vel uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	cycle := amberColorCycle[amberNote]
+	blueNote := amberCycleTarget[amberNote]
+	if !padMayChange(blueNote) {
+		return
+	}
+	i := (amberCycleIndex[amberNote] + 1) % len(cycle)
+	amberCycleIndex[amberNote] = i
+
+	color := cycle[i]
+	on := color != colorOff
+	padSource[blueNote] = sourcePad
+	padState[blueNote] = on
+	padColors[noteToPayloadPos[blueNote]] = color
+
+	padState[amberNote] = on
+	if on {
+		padColors[noteToPayloadPos[amberNote]] = lpd8.ScaleColor(onColor(amberNote), vel)
+	} else {
+		padColors[noteToPayloadPos[amberNote]] = colorOff
+	}
+
+	debugLog("Amber %d color cycle %d/%d: Blue %d %v", amberNote, i+1, len(cycle), blueNote, color)
+	resetAutoOffLocked(amberNote)
+	queueSend()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Double tap: a pad in DoubleTap does its double-tap action when pressed
+// twice within DoubleTapMs, instead of toggling twice. A single tap waits
+// out the window before it toggles, so it lands up to one window late.
+
+const defaultDoubleTapWindow = 300 * time.Millisecond
+
+// Double-tap action turning the pad on and the rest of its row off; the
+// long-press actions are also accepted
+const doubleTapSolo = "solo"
+
+// Set from config
+var (
+	doubleTapActions = map[uint8]longPressAction{}
+	doubleTapWindow  = defaultDoubleTapWindow
+)
+
+// A double-tap pad's first press, waiting for a second one
+type doubleTapWait struct {
+	timer *time.Timer
+	ts    int32 // MIDI timestamp in ms (0 = none)
+	at    time.Time
+}
+
+var doubleTapPending = make(map[heldKey]*doubleTapWait)
+var doubleTapMutex sync.Mutex
+
+// Parse a double-tap action: "solo" or any long-press action
+func parseDoubleTapAction(s string) (longPressAction, error) {
+	if s == doubleTapSolo {
+		return longPressAction{kind: doubleTapSolo}, nil
+	}
+	action, err := parseLongPressAction(s)
+	if err != nil {
+		return longPressAction{}, fmt.Errorf("unknown action (want %q, %q, \"%sN\" or \"%sN\")", doubleTapSolo, longPressAllOff, longPressStoreScene, longPressRecallScene)
+	}
+	return action, nil
+}
+
+// Handle a press of a pad with a double-tap action; returns false if it has
+// none, so the press should be handled now. Otherwise a second press within
+// the window runs the action, and single runs once the window passes
+// without one. ts is the MIDI timestamp in ms (0 = none, use arrival time).
+func startDoubleTap(source string, note uint8, ts int32, single func()) bool {
+	action, ok := doubleTapActions[note]
+	if !ok {
+		return false
+	}
+
+	doubleTapMutex.Lock()
+	key := heldKey{source, note}
+	if first, ok := doubleTapPending[key]; ok {
+		gap := time.Since(first.at)
+		if ts != 0 && first.ts != 0 {
+			gap = time.Duration(ts-first.ts) * time.Millisecond
+		}
+		// Stop fails once the single tap has run; this press starts over
+		if gap <= doubleTapWindow && first.timer.Stop() {
+			delete(doubleTapPending, key)
+			doubleTapMutex.Unlock()
+			debugLog("%s pad %d double tap (%v apart)", source, note, gap)
+			runDoubleTapAction(note, action)
+			return true
+		}
+	}
+
+	wait := &doubleTapWait{ts: ts, at: time.Now()}
+	wait.timer = time.AfterFunc(doubleTapWindow, func() {
+		doubleTapMutex.Lock()
+		if doubleTapPending[key] == wait {
+			delete(doubleTapPending, key)
+		}
+		doubleTapMutex.Unlock()
+
+		mappingsMutex.RLock()
+		defer mappingsMutex.RUnlock()
+		single()
+	})
+	doubleTapPending[key] = wait
+	doubleTapMutex.Unlock()
+	return true
+}
+
+func runDoubleTapAction(note uint8, action longPressAction) {
+	if action.kind == doubleTapSolo {
+		soloPad(note)
+		return
+	}
+	runLongPressAction(action)
+}
+
+// Turn a pad on and every other pad in its row off, in a single SysEx
+// (pads owned by a feature keep showing its state)
+func soloPad(note uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pushUndoLocked()
+	for other, pos := range noteToPayloadPos {
+		if isTopRow[other] != isTopRow[note] || reservedPads[other] || !padMayChange(other) {
+			continue
+		}
+		padSource[other] = sourcePad
+		padState[other] = other == note
+		if other == note {
+			padColors[pos] = onColor(other)
+		} else {
+			padColors[pos] = colorOff
+		}
+	}
+	queueSend()
+
+	log.Printf("Double tap: pad %d solo", note)
+}
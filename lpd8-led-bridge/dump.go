@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// State dump on SIGUSR1 (macOS/Linux): the pad state, colors, active config
+// and channels are written to stderr as indented JSON, for live debugging
+// without the HTTP API
+//
+//	kill -USR1 $(pgrep lpd8-led-bridge)
+
+type stateDump struct {
+	stateSnapshot
+	ConfigPath  string `json:"config_path"`  // Active config ("" = built-in defaults)
+	Channel     int    `json:"channel"`      // Pad channel, 1-16 or 0 for all
+	KnobChannel int    `json:"knob_channel"` // Knob channel, 1-16 or 0 for all
+}
+
+// Write the current state as JSON; stateMutex is only held to copy it
+func dumpState(w io.Writer, configPath string) error {
+	dump := stateDump{
+		stateSnapshot: snapshotState(),
+		ConfigPath:    configPath,
+	}
+	stateMutex.Lock()
+	if lpd8Channel != 255 {
+		dump.Channel = int(lpd8Channel) + 1
+	}
+	if lpd8KnobChannel != 255 {
+		dump.KnobChannel = int(lpd8KnobChannel) + 1
+	}
+	stateMutex.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// Dump the state on each dump signal until ctx is done
+func watchDumpSignal(ctx context.Context, configPath string) {
+	if len(dumpSignals) == 0 {
+		return
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, dumpSignals...)
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-sigChan:
+				if err := dumpState(os.Stderr, activeConfigPath(configPath)); err != nil {
+					log.Printf("State dump failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
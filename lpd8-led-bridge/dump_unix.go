@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that dump the state (see dump.go)
+var dumpSignals = []os.Signal{syscall.SIGUSR1}
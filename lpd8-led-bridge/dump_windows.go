@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// Windows has no SIGUSR1, so there is no state dump signal; use the HTTP API
+var dumpSignals []os.Signal
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Environment variables that supply a flag's value when it isn't given on
+// the command line (for containers and kiosks); an explicit flag always wins
+var envFlags = []struct {
+	env  string
+	flag string
+}{
+	{"LPD8_OUT", "out"},
+	{"LPD8_SPY", "spy"},
+	{"LPD8_CONFIG", "config"},
+	{"LPD8_DEBUG", "debug"},
+}
+
+// Apply envFlags for flags left unset after flag.Parse
+func applyEnvDefaults() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, e := range envFlags {
+		value := os.Getenv(e.env)
+		if value == "" || set[e.flag] {
+			continue
+		}
+		// -config-dir replaces -config rather than conflicting with it
+		if e.flag == "config" && set["config-dir"] {
+			continue
+		}
+		if err := flag.Set(e.flag, value); err != nil {
+			return fmt.Errorf("%s=%q: %v", e.env, value, err)
+		}
+		log.Printf("Using %s=%s for -%s", e.env, value, e.flag)
+	}
+	return nil
+}
+
+// Print the environment variables for the usage text
+func printEnvUsage() {
+	fmt.Println("Environment (used for flags not given on the command line; flags win):")
+	for _, e := range envFlags {
+		fmt.Printf("  %-16s -%s\n", e.env, e.flag)
+	}
+}
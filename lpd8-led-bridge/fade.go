@@ -0,0 +1,79 @@
+package main
+
+import "time"
+
+// Fade transitions (fade_ms): padState and padColors still change at once,
+// but the frame sender shows each pad's color easing from what it showed to
+// its new color over fadeDuration, re-queueing frames until every fade is
+// done. Blinking and the master brightness apply on top, unfaded.
+
+// Fade length, set from config (0 = instant) or a knob_fade_time knob
+var fadeDuration time.Duration
+
+// Longest fade a knob_fade_time knob sets when it has no max
+const defaultKnobFadeMax = 1000
+
+var knobFadeTime = map[uint8]time.Duration{} // CC -> fade length at knob value 127
+
+// A pad's fade from one color to another (guarded by stateMutex)
+type padFade struct {
+	from, to Color
+	start    time.Time
+}
+
+var fades [8]padFade
+
+// The color a fade shows at now
+func (f padFade) at(now time.Time) Color {
+	elapsed := now.Sub(f.start)
+	if fadeDuration <= 0 || elapsed >= fadeDuration {
+		return f.to
+	}
+	t := float64(elapsed) / float64(fadeDuration)
+	lerp := func(a, b byte) byte {
+		return byte(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+	return Color{R: lerp(f.from.R, f.to.R), G: lerp(f.from.G, f.to.G), B: lerp(f.from.B, f.to.B)}
+}
+
+// The colors to show at now for target (padColors): pads whose target
+// changed start fading from the color they show now. Returns true while any
+// pad is still fading.
+// Caller must hold stateMutex
+func fadeColorsLocked(target [8]Color, now time.Time) ([8]Color, bool) {
+	if fadeDuration <= 0 {
+		for i, c := range target {
+			fades[i] = padFade{from: c, to: c}
+		}
+		return target, false
+	}
+
+	var colors [8]Color
+	fading := false
+	for i, c := range target {
+		if fades[i].to != c {
+			fades[i] = padFade{from: fades[i].at(now), to: c, start: now}
+		}
+		colors[i] = fades[i].at(now)
+		if colors[i] != c {
+			fading = true
+		}
+	}
+	return colors, fading
+}
+
+// Handle a fade time knob - scale the knob value onto 0-maxFade; fades
+// already running finish at the new length
+func handleFadeKnob(cc uint8, value uint8, maxFade time.Duration) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	fade := maxFade * time.Duration(value) / 127
+	if fade == fadeDuration {
+		return
+	}
+	fadeDuration = fade
+	debugLog("Fade time CC%d=%d -> %v", cc, value, fade)
+
+	queueSend()
+}
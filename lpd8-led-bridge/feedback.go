@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// MIDI state feedback (-feedback PORT): every pad state change, whatever
+// caused it, is sent as Note On (velocity 127) or Note Off (velocity 0) for
+// the pad's note, so other software can follow the pads. Inputs with the
+// feedback port's name aren't listened to, so a loopback port can't feed
+// the bridge its own feedback.
+
+type midiFeedback struct {
+	name    string // Port name, or "" for a dry run
+	send    func(msg midi.Message) error
+	channel uint8 // 0-15
+
+	mu   sync.Mutex
+	sent map[uint8]bool // Pad states last sent
+}
+
+// Open the feedback output; channel is 1-16
+func startFeedback(name string, channel int) (*midiFeedback, error) {
+	f := &midiFeedback{channel: uint8(channel - 1), sent: make(map[uint8]bool)}
+	if dryRun {
+		return f, nil
+	}
+
+	out, err := findOutPort(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.send, err = midi.SendTo(out); err != nil {
+		return nil, err
+	}
+	f.name = out.String()
+	return f, nil
+}
+
+// Send changed pad states
+func (f *midiFeedback) sendState() {
+	snap := snapshotState()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, on := range snap.PadState {
+		n, _ := strconv.Atoi(key)
+		note := uint8(n)
+		if prev, ok := f.sent[note]; ok && prev == on {
+			continue
+		}
+
+		msg := midi.NoteOff(f.channel, note)
+		if on {
+			msg = midi.NoteOn(f.channel, note, 127)
+		}
+		if dryRun {
+			fmt.Printf("Feedback %s\n", msg)
+		} else if err := f.send(msg); err != nil {
+			log.Printf("Error sending feedback to %s: %v", f.name, err)
+			return
+		}
+		f.sent[note] = on
+	}
+}
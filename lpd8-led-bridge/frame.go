@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Output coalescer: handlers change padColors under stateMutex and call
+// queueSend to mark the frame dirty; a single sender goroutine sends the
+// latest frame at most once per frameInterval. Bursts of changes (knob
+// sweeps, animations, reloads) collapse into one SysEx, and a frame that
+// renders the same as the last one sent is skipped.
+
+// Default minimum time between frames (output_interval_ms = 0)
+const defaultFrameInterval = 10 * time.Millisecond
+
+// Minimum time between frames, set from config
+var frameInterval = defaultFrameInterval
+
+var (
+	frameDirty = make(chan struct{}, 1)
+	lastFrame  []byte // Last SysEx sent successfully (nil = send the next one regardless)
+	frameMutex sync.Mutex
+)
+
+// Mark the frame dirty; the sender picks up the current padColors
+// Never blocks, so it's safe to call while holding stateMutex
+func queueSend() {
+	select {
+	case frameDirty <- struct{}{}:
+	default:
+	}
+}
+
+// Send the next frame even if it matches the last one (e.g. after the
+// device reconnects and has lost its LED state)
+func resendFrame() {
+	frameMutex.Lock()
+	lastFrame = nil
+	frameMutex.Unlock()
+	queueSend()
+}
+
+// Start the sender goroutine sending frames to out until ctx is done; the
+// returned function waits for it to stop, then sends any pending frame
+func startFrameSender(ctx context.Context, out Sender) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-frameDirty:
+			case <-ctx.Done():
+				return
+			}
+			interval := flushFrame(out)
+
+			// Rate limit: changes during the wait go out in the next frame
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		<-done
+		select {
+		case <-frameDirty:
+			flushFrame(out)
+		default:
+		}
+	}
+}
+
+// Send the current padColors unless unchanged since the last frame
+// Returns the interval to wait before the next frame
+func flushFrame(out Sender) time.Duration {
+	stateMutex.Lock()
+	colors, fading := fadeColorsLocked(padColors, time.Now())
+	snap := stateSnapshot{PadState: padStateKeysLocked(), PadColors: renderColors(colors)}
+	noticeStateLocked()
+	sysex := renderer.BuildSysEx(snap.PadColors)
+	interval := frameInterval
+	stateMutex.Unlock()
+
+	// Fading pads need further frames even without further changes
+	if fading {
+		queueSend()
+	}
+
+	frameMutex.Lock()
+	defer frameMutex.Unlock()
+
+	if bytes.Equal(sysex, lastFrame) {
+		return interval
+	}
+	if err := out.Send(sysex); err != nil {
+		log.Printf("Error sending SysEx: %v", err)
+		metricSendErrors.Add(1)
+		lastFrame = nil
+		return interval
+	}
+	metricSysExSent.Add(1)
+	lastFrame = sysex
+	stateHub.broadcast(snap)
+	return interval
+}
@@ -0,0 +1,49 @@
+package main
+
+import "lpd8-led-bridge/pkg/lpd8"
+
+// Gamma correction for knob brightness: perceived LED brightness isn't
+// linear in the value sent, so a linear knob does most of its visible
+// dimming in one part of its travel. Knob brightness goes through a lookup
+// table of 127 * (v/127)^gamma instead, built when the config loads, so
+// turning the knob feels even.
+
+const defaultKnobGamma = 2.2
+
+// Knob brightness (0-127) -> corrected brightness, set from config
+var knobGammaTable = lpd8.GammaTable(defaultKnobGamma)
+
+const (
+	defaultKnobInMax  = 64
+	defaultKnobOutMax = 127
+)
+
+// Knob input and brightness output ranges (min, max), set from config
+var (
+	knobInRange  = [2]int{0, defaultKnobInMax}
+	knobOutRange = [2]int{0, defaultKnobOutMax}
+)
+
+// Knob ranges from config, with 0 maxes filled in
+func knobRanges(cfg Config) (in, out [2]int) {
+	in = [2]int{cfg.KnobInMin, cfg.KnobInMax}
+	if in[1] == 0 {
+		in[1] = defaultKnobInMax
+	}
+	out = [2]int{cfg.KnobOutMin, cfg.KnobOutMax}
+	if out[1] == 0 {
+		out[1] = defaultKnobOutMax
+	}
+	return in, out
+}
+
+// Map a knob value onto the brightness range, before gamma correction.
+// Each input step is worth (out span + 1) / (in span), so knob_in_max
+// reaches knob_out_max and the defaults give exactly value*2 capped at 127.
+// Values outside the input range clamp to its ends.
+func knobBrightness(value uint8) uint8 {
+	in, out := knobInRange, knobOutRange
+	v := min(max(int(value), in[0]), in[1])
+	b := out[0] + (v-in[0])*(out[1]-out[0]+1)/(in[1]-in[0])
+	return uint8(min(b, out[1]))
+}
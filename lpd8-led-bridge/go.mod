@@ -2,4 +2,24 @@ module lpd8-led-bridge
 
 go 1.22.2
 
-require gitlab.com/gomidi/midi/v2 v2.2.10
+require (
+	github.com/getlantern/systray v1.2.2
+	github.com/micmonay/keybd_event v1.1.2
+	gitlab.com/gomidi/midi/v2 v2.2.10
+	go.bug.st/serial v1.6.2
+	golang.org/x/term v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/creack/goselect v0.1.2 // indirect
+	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520 // indirect
+	github.com/getlantern/errors v0.0.0-20190325191628-abdb3e3e36f7 // indirect
+	github.com/getlantern/golog v0.0.0-20190830074920-4ef2e798c2d7 // indirect
+	github.com/getlantern/hex v0.0.0-20190417191902-c6586a6fe0b7 // indirect
+	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 // indirect
+	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
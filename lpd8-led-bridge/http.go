@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP API for reading and setting pad state remotely
+//
+//	GET  /state       -> {"pad_state": {"40": true, ...}, "pad_colors": [{"r":0,"g":0,"b":127}, ...]}
+//	POST /pad/{note}  <- {"on": true}
+//	GET  /ws          -> WebSocket pushing the /state JSON on every LED update (see websocket.go)
+//
+// All reads and writes go through stateMutex (and mappingsMutex), same as
+// MIDI-driven updates.
+
+// Snapshot of the pad state, as returned by GET /state
+type stateSnapshot struct {
+	PadState  map[string]bool `json:"pad_state"`  // Pad note -> on
+	PadColors [8]Color        `json:"pad_colors"` // Rendered colors by SysEx payload position
+}
+
+func snapshotState() stateSnapshot {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	return stateSnapshot{PadState: padStateKeysLocked(), PadColors: padColors}
+}
+
+// Pad states keyed by note as a string, for JSON; caller holds stateMutex
+func padStateKeysLocked() map[string]bool {
+	states := make(map[string]bool, len(noteToPayloadPos))
+	for note := range noteToPayloadPos {
+		states[strconv.Itoa(int(note))] = padState[note]
+	}
+	return states
+}
+
+func newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", handleGetState)
+	mux.HandleFunc("POST /pad/{note}", handleSetPad)
+	mux.HandleFunc("GET /ws", handleWebSocket)
+	return mux
+}
+
+func handleGetState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, snapshotState())
+}
+
+func handleSetPad(w http.ResponseWriter, r *http.Request) {
+	mappingsMutex.RLock()
+	defer mappingsMutex.RUnlock()
+
+	n, err := strconv.Atoi(r.PathValue("note"))
+	if err != nil || n < 0 || n > 127 {
+		http.Error(w, "invalid note", http.StatusNotFound)
+		return
+	}
+	note := uint8(n)
+	if _, ok := noteToPayloadPos[note]; !ok {
+		http.Error(w, "unknown pad", http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		On *bool `json:"on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.On == nil {
+		http.Error(w, `body must be {"on": true|false}`, http.StatusBadRequest)
+		return
+	}
+
+	debugLog("HTTP: pad %d -> %v", note, *body.On)
+	setPad(ledOut, note, *body.On)
+	writeJSON(w, http.StatusOK, snapshotState())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		debugLog("HTTP: write failed: %v", err)
+	}
+}
+
+// Start the HTTP API on addr, shutting it down when ctx is done; the
+// returned function waits for the shutdown
+func startHTTPServer(ctx context.Context, addr string) func() {
+	stop := serveHTTP(ctx, addr, newHTTPHandler())
+	log.Printf("HTTP API listening on %s", addr)
+	return func() {
+		stop()
+		stateHub.closeAll()
+	}
+}
+
+// Serve h on addr until ctx is done; the returned function waits for the
+// shutdown
+func serveHTTP(ctx context.Context, addr string, h http.Handler) func() {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error on %s: %v", addr, err)
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	return func() {
+		<-done
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// SysEx input: with -identify the bridge sends a Universal Identity Request
+// to the outputs once its inputs are attached and logs the reply, and with
+// -debug every SysEx arriving on the LPD8 inputs is hex-dumped. Both help
+// confirm which firmware a device has and that the LED header suits it.
+
+// Universal Identity Request to all devices (F0 7E 7F 06 01 F7)
+var identityRequest = []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+
+// Manufacturer ID in identity replies for Akai
+const akaiID = 0x47
+
+// Send the identity request to the LED outputs (stdout for a dry run)
+func requestIdentity(out Sender) {
+	if dryRun {
+		fmt.Printf("Identity request: % X\n", identityRequest)
+		return
+	}
+	if err := out.Send(identityRequest); err != nil {
+		log.Printf("Identity request failed: %v", err)
+		return
+	}
+	log.Println("Identity request sent, waiting for replies")
+}
+
+// Handle a SysEx from an LPD8 input: log identity replies, hex-dump the rest
+// in debug mode. Our own LED SysEx (e.g. on a loopback port) is skipped.
+func handleSysExInput(msg midi.Message) {
+	if bytes.HasPrefix(msg, sysExHeader) {
+		return
+	}
+	var data []byte
+	if !msg.GetSysEx(&data) {
+		return
+	}
+
+	// Identity Reply: 7E <device> 06 02 <manufacturer> <family x2> <model x2> <version x4>
+	if len(data) >= 13 && data[0] == 0x7E && data[2] == 0x06 && data[3] == 0x02 {
+		maker := fmt.Sprintf("%02X", data[4])
+		if data[4] == akaiID {
+			maker = "Akai"
+		}
+		log.Printf("Identity reply: manufacturer %s, family %02X %02X, model %02X %02X, version %02X %02X %02X %02X",
+			maker, data[5], data[6], data[7], data[8], data[9], data[10], data[11], data[12])
+	}
+	debugLog("SysEx in (%d bytes): % X", len(msg), []byte(msg))
+}
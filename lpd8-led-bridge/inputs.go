@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// Input hotplug (-watch-inputs): inputs are normally enumerated once at
+// startup. With -watch-inputs the port list is polled, ports that appear
+// are offered to the same attach logic as at startup (LPD8 or spy handler,
+// or skipped), and ports that vanish have their listener stopped.
+
+// How often -watch-inputs polls the input ports
+const inputWatchInterval = 3 * time.Second
+
+// Attached MIDI inputs: port name -> stop function
+type inputSet struct {
+	mu    sync.Mutex
+	stops map[string]func()
+}
+
+func newInputSet() *inputSet {
+	return &inputSet{stops: make(map[string]func())}
+}
+
+func (s *inputSet) add(name string, stop func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stops[name] = stop
+}
+
+func (s *inputSet) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.stops[name]
+	return ok
+}
+
+func (s *inputSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.stops)
+}
+
+// Stop listening on every input not in present; returns the names dropped
+func (s *inputSet) dropMissing(present map[string]bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dropped []string
+	for name, stop := range s.stops {
+		if !present[name] {
+			stop()
+			delete(s.stops, name)
+			dropped = append(dropped, name)
+		}
+	}
+	return dropped
+}
+
+// Stop listening on every input
+func (s *inputSet) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, stop := range s.stops {
+		stop()
+		delete(s.stops, name)
+	}
+}
+
+// Poll the input ports until ctx is done: vanished ports are dropped from
+// inputs, and each port that wasn't there at the last poll (or startup) and
+// isn't attached is passed to attach. The returned function waits for the
+// poller to stop.
+func watchInputs(ctx context.Context, inputs *inputSet, attach func(drivers.In)) func() {
+	done := make(chan struct{})
+
+	seen := make(map[string]bool)
+	for _, in := range midi.GetInPorts() {
+		seen[in.String()] = true
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(inputWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			ports := midi.GetInPorts()
+			present := make(map[string]bool, len(ports))
+			for _, in := range ports {
+				present[in.String()] = true
+			}
+			for _, name := range inputs.dropMissing(present) {
+				log.Printf("MIDI input gone, stopped listening: %s", name)
+			}
+			for _, in := range ports {
+				if !seen[in.String()] && !inputs.has(in.String()) {
+					log.Printf("New MIDI input: %s", in)
+					attach(in)
+				}
+			}
+			seen = present
+		}
+	}()
+
+	return func() { <-done }
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// Keystroke injection: pads that turn on can also press a key combination,
+// e.g. "ctrl+shift+a", for software that listens to the keyboard not MIDI
+
+// Key combination parsed from a key_map value
+type keyCombo struct {
+	ctrl, alt, shift, super bool
+	key                     int // keybd_event VK_* code
+}
+
+// Pad note -> key combination, set from config
+var keyMap = map[uint8]keyCombo{}
+
+// Key names accepted in key_map (modifiers are handled separately)
+var keyCodes = map[string]int{
+	"a": keybd_event.VK_A, "b": keybd_event.VK_B, "c": keybd_event.VK_C, "d": keybd_event.VK_D,
+	"e": keybd_event.VK_E, "f": keybd_event.VK_F, "g": keybd_event.VK_G, "h": keybd_event.VK_H,
+	"i": keybd_event.VK_I, "j": keybd_event.VK_J, "k": keybd_event.VK_K, "l": keybd_event.VK_L,
+	"m": keybd_event.VK_M, "n": keybd_event.VK_N, "o": keybd_event.VK_O, "p": keybd_event.VK_P,
+	"q": keybd_event.VK_Q, "r": keybd_event.VK_R, "s": keybd_event.VK_S, "t": keybd_event.VK_T,
+	"u": keybd_event.VK_U, "v": keybd_event.VK_V, "w": keybd_event.VK_W, "x": keybd_event.VK_X,
+	"y": keybd_event.VK_Y, "z": keybd_event.VK_Z,
+	"0": keybd_event.VK_0, "1": keybd_event.VK_1, "2": keybd_event.VK_2, "3": keybd_event.VK_3,
+	"4": keybd_event.VK_4, "5": keybd_event.VK_5, "6": keybd_event.VK_6, "7": keybd_event.VK_7,
+	"8": keybd_event.VK_8, "9": keybd_event.VK_9,
+	"f1": keybd_event.VK_F1, "f2": keybd_event.VK_F2, "f3": keybd_event.VK_F3, "f4": keybd_event.VK_F4,
+	"f5": keybd_event.VK_F5, "f6": keybd_event.VK_F6, "f7": keybd_event.VK_F7, "f8": keybd_event.VK_F8,
+	"f9": keybd_event.VK_F9, "f10": keybd_event.VK_F10, "f11": keybd_event.VK_F11, "f12": keybd_event.VK_F12,
+	"space": keybd_event.VK_SPACE, "enter": keybd_event.VK_ENTER, "tab": keybd_event.VK_TAB,
+	"esc": keybd_event.VK_ESC, "delete": keybd_event.VK_DELETE,
+	"home": keybd_event.VK_HOME, "end": keybd_event.VK_END,
+	"pageup": keybd_event.VK_PAGEUP, "pagedown": keybd_event.VK_PAGEDOWN,
+	"left": keybd_event.VK_LEFT, "right": keybd_event.VK_RIGHT,
+	"up": keybd_event.VK_UP, "down": keybd_event.VK_DOWN,
+}
+
+// Parse a combination like "ctrl+shift+a": any modifiers plus exactly one key
+func parseKeyCombo(s string) (keyCombo, error) {
+	var combo keyCombo
+	haveKey := false
+	for _, part := range strings.Split(strings.ToLower(s), "+") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "ctrl":
+			combo.ctrl = true
+		case "alt":
+			combo.alt = true
+		case "shift":
+			combo.shift = true
+		case "super", "cmd", "win":
+			combo.super = true
+		default:
+			code, ok := keyCodes[part]
+			if !ok {
+				return combo, fmt.Errorf("unknown key %q", part)
+			}
+			if haveKey {
+				return combo, fmt.Errorf("more than one key in %q", s)
+			}
+			combo.key = code
+			haveKey = true
+		}
+	}
+	if !haveKey {
+		return combo, fmt.Errorf("no key in %q", s)
+	}
+	return combo, nil
+}
+
+// Presses waiting for the injector; a full queue drops presses rather than
+// blocking MIDI handling
+var (
+	keyQueue     = make(chan keyCombo, 16)
+	keyQueueOnce sync.Once
+)
+
+// Press a pad's key combination if it has one and the pad is now on
+// Caller must not hold stateMutex
+func pressKeys(note uint8) {
+	combo, ok := keyMap[note]
+	if !ok {
+		return
+	}
+	stateMutex.Lock()
+	on := padState[note]
+	stateMutex.Unlock()
+	if !on {
+		return
+	}
+
+	keyQueueOnce.Do(func() { go runKeyInjector(keyQueue) })
+	select {
+	case keyQueue <- combo:
+	default:
+		log.Printf("Key injection busy, dropping keys for pad %d", note)
+	}
+}
+
+// Inject queued key combinations one at a time
+func runKeyInjector(queue chan keyCombo) {
+	kb, err := keybd_event.NewKeyBonding()
+	if err != nil {
+		log.Printf("Key injection unavailable: %v", err)
+		for range queue { // Discard so presses don't log as dropped
+		}
+		return
+	}
+	// The virtual keyboard takes a moment to appear on Linux
+	if runtime.GOOS == "linux" {
+		time.Sleep(2 * time.Second)
+	}
+
+	for combo := range queue {
+		kb.Clear()
+		kb.SetKeys(combo.key)
+		kb.HasCTRL(combo.ctrl)
+		kb.HasALT(combo.alt)
+		kb.HasSHIFT(combo.shift)
+		kb.HasSuper(combo.super)
+		if err := kb.Launching(); err != nil {
+			log.Printf("Key injection failed: %v", err)
+		}
+	}
+}
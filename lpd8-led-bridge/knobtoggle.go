@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Knob toggles (knob_to_toggle): a CC, e.g. from an endless encoder or a
+// CC button, that presses a pad instead of dimming it, going through the
+// same press and release handling as the LPD8's own pads (feature pads,
+// long press, double tap, filters) under its own source. A value
+// at/above triggerCCThreshold presses the pad and a value below it
+// releases it, so a momentary pad stays lit while the knob is up. Values
+// that stay at/above the threshold don't press again unless the CC goes
+// quiet for knobToggleDebounce, which counts as a release and a new press,
+// so one push or turn toggles once.
+
+const knobToggleDebounce = 250 * time.Millisecond
+
+// Source name for knob toggle presses, kept apart from the LPD8's pads for
+// debounce and held-note tracking
+const knobToggleSource = "knob"
+
+// CC -> pad note, set from config
+var knobToToggle = map[uint8]uint8{}
+
+var (
+	knobToggleLast  = make(map[uint8]time.Time) // CC -> last value at/above the threshold while held
+	knobToggleMutex sync.Mutex
+)
+
+// Whether a knob toggle CC value releases and/or presses its pad (a
+// release comes first)
+func knobToggleStep(cc uint8, value uint8) (release, press bool) {
+	knobToggleMutex.Lock()
+	defer knobToggleMutex.Unlock()
+
+	last, held := knobToggleLast[cc]
+	if value < triggerCCThreshold {
+		delete(knobToggleLast, cc)
+		return held, false
+	}
+	now := time.Now()
+	knobToggleLast[cc] = now
+	if !held {
+		return false, true
+	}
+	quiet := now.Sub(last) > knobToggleDebounce
+	return quiet, quiet
+}
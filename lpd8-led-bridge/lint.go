@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Config linter (-lint FILE): load-time validation (errors) plus mappings
+// that load fine but can never do anything (warnings), checked without
+// any MIDI hardware
+
+// Lint a config file, printing each problem and a summary; returns the
+// process exit code (1 if there were errors)
+func runLint(path string) int {
+	var errs, warnings []string
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		if err := validateConfig(cfg); err != nil {
+			errs = append(errs, err.Error())
+		}
+		warnings = lintConfig(cfg)
+	}
+
+	for _, e := range errs {
+		fmt.Printf("error: %s\n", e)
+	}
+	for _, w := range warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", path, len(errs), len(warnings))
+
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Find dead and conflicting mappings validation lets through
+func lintConfig(cfg Config) []string {
+	var warnings []string
+	warn := func(format string, v ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	pads := make(map[int]bool)
+	for _, note := range cfg.LPD8.TopRow {
+		pads[note] = true
+	}
+	for _, note := range cfg.LPD8.BottomRow {
+		pads[note] = true
+	}
+
+	// Pads owned by a feature, which buildMappings drops as targets
+	reserved := make(map[int]string)
+	for _, f := range []struct {
+		field string
+		notes []int
+	}{
+		{"clock_indicator_note", []int{cfg.ClockIndicatorNote}},
+		{"record_note", []int{cfg.RecordNote}},
+		{"play_note", []int{cfg.PlayNote}},
+		{"tap_tempo_note", []int{cfg.TapTempoNote}},
+		{"polarity_toggle_note", []int{cfg.PolarityToggleNote}},
+		{"palette_cycle_note", []int{cfg.PaletteCycleNote}},
+		{"scene_store", cfg.SceneStore},
+		{"scene_recall", cfg.SceneRecall},
+	} {
+		for _, note := range f.notes {
+			if note != 0 {
+				reserved[note] = f.field
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(cfg.SpyRemap) {
+		if note := cfg.SpyRemap[key]; !pads[note] {
+			warn("spy_remap[%q] = %d is not a pad in lpd8.top_row or lpd8.bottom_row, so those spy presses do nothing", key, note)
+		}
+	}
+	for _, port := range sortedKeys(cfg.SpyRemapByPort) {
+		remap := cfg.SpyRemapByPort[port]
+		for _, key := range sortedKeys(remap) {
+			if note := remap[key]; !pads[note] {
+				warn("spy_remap_by_port[%q][%q] = %d is not a pad in lpd8.top_row or lpd8.bottom_row, so those spy presses do nothing", port, key, note)
+			}
+		}
+	}
+	for _, key := range sortedKeys(cfg.AmberToBlues) {
+		amber, _ := strconv.Atoi(key)
+		if field, ok := reserved[amber]; ok {
+			warn("amber_to_blues key %q is the %s pad, so it never controls its blues", key, field)
+		} else if slices.Contains(cfg.LPD8.Momentary, amber) {
+			warn("amber_to_blues key %q is a momentary pad, so it never controls its blues", key)
+		}
+		for i, blue := range cfg.AmberToBlues[key] {
+			if field, ok := reserved[blue]; ok {
+				warn("amber_to_blues[%q][%d] = %d is the %s pad, so the amber never changes it", key, i, blue, field)
+			}
+		}
+	}
+	for _, key := range sortedKeys(cfg.AmberToColorCycle) {
+		amber, _ := strconv.Atoi(key)
+		if col := slices.Index(cfg.LPD8.BottomRow[:], amber); col >= 0 {
+			if field, ok := reserved[cfg.LPD8.TopRow[col]]; ok {
+				warn("amber_to_color_cycle key %q steps pad %d, which is the %s pad, so the amber does nothing", key, cfg.LPD8.TopRow[col], field)
+			}
+		}
+	}
+	for _, key := range sortedKeys(cfg.InitialState) {
+		note, _ := strconv.Atoi(key)
+		if field, ok := reserved[note]; ok && cfg.InitialState[key] {
+			warn("initial_state key %q is the %s pad, which always starts dark", key, field)
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobToBlue) {
+		if field, ok := reserved[cfg.KnobToBlue[key]]; ok {
+			warn("knob_to_blue[%q] = %d is the %s pad, so the knob does nothing", key, cfg.KnobToBlue[key], field)
+		}
+	}
+	if cfg.KnobVsPadPriority == "" {
+		for _, key := range sortedKeys(cfg.KnobToBlue) {
+			note := cfg.KnobToBlue[key]
+			if _, ok := reserved[note]; ok || !pads[note] || slices.Contains(cfg.LPD8.Momentary, note) {
+				continue
+			}
+			warn("knob_to_blue[%q] = %d is also a toggle pad, so pad and knob fight over it; set knob_vs_pad_priority to pick one", key, note)
+		}
+	}
+	if slot := cfg.AftertouchScene; slot > 0 {
+		action := fmt.Sprintf("%s%d", longPressStoreScene, slot)
+		stored := slices.ContainsFunc([][]int{cfg.SceneStore, cfg.SceneStoreCC}, func(controls []int) bool {
+			return slot <= len(controls) && controls[slot-1] != 0
+		})
+		for _, actions := range []map[string]string{cfg.LongPress, cfg.DoubleTap} {
+			for _, a := range actions {
+				stored = stored || a == action
+			}
+		}
+		if !stored {
+			warn("aftertouch_scene = %d, but nothing stores scene %d, so pressing hard does nothing", slot, slot)
+		}
+	}
+	if len(cfg.Palettes) > 0 && cfg.PaletteCycleNote == 0 {
+		warn("palettes are set but palette_cycle_note is 0, so they're never used")
+	} else if cfg.PaletteCycleNote != 0 && len(cfg.Palettes) == 0 {
+		warn("palette_cycle_note is set but there are no palettes to cycle through")
+	}
+	if cfg.UseReleaseVelocity && len(cfg.LPD8.Momentary) == 0 {
+		warn("use_release_velocity only affects lpd8.momentary pads, and there are none")
+	}
+	for i, cc := range cfg.KnobMomentary {
+		if _, ok := cfg.KnobToBlue[strconv.Itoa(cc)]; !ok {
+			warn("knob_momentary[%d] = %d is not a knob_to_blue CC, so it has no effect", i, cc)
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobToChannel) {
+		note := cfg.KnobToChannel[key].Note
+		if field, ok := reserved[note]; ok {
+			warn("knob_to_channel[%q].note = %d is the %s pad, so the knob does nothing", key, note, field)
+		}
+	}
+	for _, f := range []struct {
+		field string
+		notes []int
+	}{
+		{"blink", cfg.Blink},
+		{"lpd8.momentary", cfg.LPD8.Momentary},
+	} {
+		for i, note := range f.notes {
+			if field, ok := reserved[note]; ok {
+				warn("%s[%d] = %d is the %s pad, so it has no effect", f.field, i, note, field)
+			}
+		}
+	}
+	for _, m := range []struct {
+		field string
+		keys  []string
+	}{
+		{"key_map", sortedKeys(cfg.KeyMap)},
+		{"pad_to_program_change", sortedKeys(cfg.PadToProgramChange)},
+		{"long_press", sortedKeys(cfg.LongPress)},
+		{"double_tap", sortedKeys(cfg.DoubleTap)},
+		{"blink_rates", sortedKeys(cfg.BlinkRates)},
+		{"amber_to_color_cycle", sortedKeys(cfg.AmberToColorCycle)},
+		{"split_pads", sortedKeys(cfg.SplitPads)},
+	} {
+		for _, key := range m.keys {
+			note, _ := strconv.Atoi(key)
+			if field, ok := reserved[note]; ok {
+				warn("%s key %q is the %s pad, so it never fires", m.field, key, field)
+			}
+		}
+	}
+
+	// CCs handled by more than one feature: the first owner, in the order
+	// the bridge checks them, gets every message
+	ccOwner := make(map[int]string)
+	claim := func(field string, cc int) {
+		if owner, ok := ccOwner[cc]; ok {
+			warn("%s CC %d is also %s, which takes it, so %s never sees it", field, cc, owner, field)
+			return
+		}
+		ccOwner[cc] = field
+	}
+	claimKeys := func(field string, keys []string) {
+		for _, key := range keys {
+			cc, _ := strconv.Atoi(key)
+			claim(field, cc)
+		}
+	}
+	claimList := func(field string, ccs []int) {
+		for _, cc := range ccs {
+			if cc != 0 { // 0 = unused slot
+				claim(field, cc)
+			}
+		}
+	}
+	claimList("panic_cc", []int{cfg.PanicCC}) // Checked before anything else, on any channel
+	claimList("undo_cc", []int{cfg.UndoCC})
+	// Feedback CCs only shadow knobs when the channels overlap
+	if fb, knob := cfg.CCFeedbackChannel, cfg.LPD8.KnobChannel; fb == 0 || knob == 0 || fb == knob {
+		claimKeys("cc_feedback", sortedKeys(cfg.CCFeedback))
+	}
+	claimKeys("knob_to_toggle", sortedKeys(cfg.KnobToToggle))
+	claimList("scene_store_cc", cfg.SceneStoreCC)
+	claimList("scene_recall_cc", cfg.SceneRecallCC)
+	claimList("brightness_cc", []int{cfg.BrightnessCC})
+	claimKeys("knob_comet", sortedKeys(cfg.KnobComet))
+	claimKeys("knob_color_temp", sortedKeys(cfg.KnobColorTemp))
+	claimKeys("knob_fade_time", sortedKeys(cfg.KnobFadeTime))
+	claimKeys("knob_to_channel", sortedKeys(cfg.KnobToChannel))
+	claimKeys("knob_to_blue", sortedKeys(cfg.KnobToBlue))
+
+	return warnings
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Long press: a pad in LongPress does its normal press on a quick tap, and
+// its long-press action instead once held for LongPressMs. The tap waits for
+// the Note Off, so it lands on release rather than on press.
+
+const defaultLongPressThreshold = 500 * time.Millisecond
+
+// Long-press actions
+const (
+	longPressAllOff      = "all-off"       // Turn every pad off
+	longPressStoreScene  = "store-scene-"  // + scene number 1-4
+	longPressRecallScene = "recall-scene-" // + scene number 1-4
+)
+
+type longPressAction struct {
+	kind string // longPressAllOff, longPressStoreScene or longPressRecallScene
+	slot int    // Scene slot (0-3) for scene actions
+}
+
+// Set from config
+var (
+	longPressActions   = map[uint8]longPressAction{}
+	longPressThreshold = defaultLongPressThreshold
+)
+
+// A long-press pad being held: the press waiting to become a tap
+type longPressHold struct {
+	timer *time.Timer
+	vel   uint8
+}
+
+var longPressHeld = make(map[heldKey]*longPressHold)
+var longPressMutex sync.Mutex
+
+// Parse a long-press action, e.g. "all-off" or "recall-scene-2"
+func parseLongPressAction(s string) (longPressAction, error) {
+	if s == longPressAllOff {
+		return longPressAction{kind: longPressAllOff}, nil
+	}
+	for _, kind := range []string{longPressStoreScene, longPressRecallScene} {
+		if num, ok := strings.CutPrefix(s, kind); ok {
+			n, err := strconv.Atoi(num)
+			if err != nil || n < 1 || n > numScenes {
+				return longPressAction{}, fmt.Errorf("scene number %q must be 1-%d", num, numScenes)
+			}
+			return longPressAction{kind: kind, slot: n - 1}, nil
+		}
+	}
+	return longPressAction{}, fmt.Errorf("unknown action (want %q, \"%sN\" or \"%sN\")", longPressAllOff, longPressStoreScene, longPressRecallScene)
+}
+
+// Start timing a press of a pad; returns false if the pad has no long-press
+// action, so the press should be handled now. Otherwise the action runs once
+// the pad has been held for the threshold, and endLongPress decides on
+// release whether it was a tap.
+func startLongPress(source string, note uint8, vel uint8) bool {
+	action, ok := longPressActions[note]
+	if !ok {
+		return false
+	}
+
+	longPressMutex.Lock()
+	defer longPressMutex.Unlock()
+
+	key := heldKey{source, note}
+	if old, ok := longPressHeld[key]; ok {
+		old.timer.Stop() // Missed Note Off; time from this press instead
+	}
+	longPressHeld[key] = &longPressHold{
+		timer: time.AfterFunc(longPressThreshold, func() {
+			mappingsMutex.RLock()
+			defer mappingsMutex.RUnlock()
+			debugLog("%s pad %d held for %v, long press", source, note, longPressThreshold)
+			runLongPressAction(action)
+		}),
+		vel: vel,
+	}
+	return true
+}
+
+// Stop timing a long-press pad on release; returns the press velocity and
+// true if it was released before the threshold (a tap)
+func endLongPress(source string, note uint8) (uint8, bool) {
+	longPressMutex.Lock()
+	defer longPressMutex.Unlock()
+
+	key := heldKey{source, note}
+	hold, ok := longPressHeld[key]
+	if !ok {
+		return 0, false
+	}
+	delete(longPressHeld, key)
+
+	// Stop fails once the timer has fired, i.e. the action already ran
+	if !hold.timer.Stop() {
+		return 0, false
+	}
+	return hold.vel, true
+}
+
+func runLongPressAction(action longPressAction) {
+	switch action.kind {
+	case longPressAllOff:
+		allPadsOff()
+	case longPressStoreScene:
+		storeScene(action.slot)
+	case longPressRecallScene:
+		recallScene(action.slot)
+	}
+}
+
+// Turn off every pad that presses can change, in a single SysEx (pads owned
+// by a feature keep showing its state)
+func allPadsOff() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pushUndoLocked()
+	for note, pos := range noteToPayloadPos {
+		if reservedPads[note] || !padMayChange(note) {
+			continue
+		}
+		padSource[note] = sourcePad
+		padState[note] = false
+		padColors[pos] = colorOff
+	}
+	queueSend()
+
+	log.Println("Long press: all pads off")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Feedback loop detection: a spy device (or any input) that echoes the LED
+// or feedback output back as presses makes a pad toggle endlessly. A pad
+// pressed more than loopMaxPresses times within loopWindow, across all
+// sources, is ignored until it has been quiet for loopWindow.
+
+const (
+	defaultLoopMaxPresses = 20
+	defaultLoopWindow     = time.Second
+)
+
+// Set from config
+var (
+	loopMaxPresses = defaultLoopMaxPresses
+	loopWindow     = defaultLoopWindow
+)
+
+type loopRecord struct {
+	presses    []time.Time // Presses within the window
+	suppressed bool
+	last       time.Time // Last press, for ending a suppression
+}
+
+var loopRecords = make(map[uint8]*loopRecord)
+var loopMutex sync.Mutex
+
+// Count a press of a pad; returns false if the pad looks like it's in a
+// feedback loop and the press should be ignored
+func loopCheck(note uint8) bool {
+	loopMutex.Lock()
+	defer loopMutex.Unlock()
+
+	now := time.Now()
+	r, ok := loopRecords[note]
+	if !ok {
+		r = &loopRecord{}
+		loopRecords[note] = r
+	}
+
+	if r.suppressed {
+		quiet := now.Sub(r.last)
+		r.last = now
+		if quiet < loopWindow {
+			return false
+		}
+		r.suppressed = false
+		r.presses = nil
+		log.Printf("Pad %d quiet for %v, no longer ignored", note, quiet)
+	}
+	r.last = now
+
+	kept := r.presses[:0]
+	for _, t := range r.presses {
+		if now.Sub(t) < loopWindow {
+			kept = append(kept, t)
+		}
+	}
+	r.presses = append(kept, now)
+
+	if len(r.presses) > loopMaxPresses {
+		r.suppressed = true
+		log.Printf("Warning: pad %d pressed %d times within %v, possible MIDI feedback loop (an input echoing the output?); ignoring it until it is quiet for %v",
+			note, len(r.presses), loopWindow, loopWindow)
+		return false
+	}
+	return true
+}
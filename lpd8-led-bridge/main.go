@@ -1,40 +1,323 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+
+	"lpd8-led-bridge/pkg/lpd8"
 
 	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
 	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv"
+	"gopkg.in/yaml.v3"
 )
 
 // Config defines the button/knob mappings
 type Config struct {
 	// LPD8 pad notes (physical layout: top row 5-8, bottom row 1-4)
 	LPD8 struct {
-		TopRow       [4]int `json:"top_row"`       // Blue pads (default: 40,41,42,43)
-		BottomRow    [4]int `json:"bottom_row"`    // Amber pads (default: 36,37,38,39)
-		Knobs        [8]int `json:"knobs"`         // CC numbers for knobs 1-8
-		Channel      int    `json:"channel"`       // MIDI channel for pads (1-16, default: 10)
-		KnobChannel  int    `json:"knob_channel"`  // MIDI channel for knobs (0=all, 1-16, default: 0)
-	} `json:"lpd8"`
+		TopRow      [4]int `json:"top_row" yaml:"top_row"`                         // Blue pads (default: 40,41,42,43)
+		BottomRow   [4]int `json:"bottom_row" yaml:"bottom_row"`                   // Amber pads (default: 36,37,38,39)
+		Knobs       [8]int `json:"knobs" yaml:"knobs"`                             // CC numbers for knobs 1-8
+		Channel     int    `json:"channel" yaml:"channel"`                         // MIDI channel for pads (0=all, 1-16, default: 10)
+		KnobChannel int    `json:"knob_channel" yaml:"knob_channel"`               // MIDI channel for knobs (0=all, 1-16, default: 0)
+		Momentary   []int  `json:"momentary,omitempty" yaml:"momentary,omitempty"` // Pads lit only while held (Note On -> on, Note Off -> off)
+	} `json:"lpd8" yaml:"lpd8"`
+
+	// Whether each pad starts on, keyed by pad note; pads not listed start
+	// top row on, bottom row off
+	InitialState map[string]bool `json:"initial_state,omitempty" yaml:"initial_state,omitempty"`
 
 	// Spy device note remapping (e.g., PLX-CRSS12)
-	SpyRemap map[string]int `json:"spy_remap"` // "32": 40 means spy note 32 -> our note 40
+	SpyRemap map[string]int `json:"spy_remap" yaml:"spy_remap"` // "32": 40 means spy note 32 -> our note 40
+
+	// Per-spy note remapping, keyed by the -spy port name (as given, or the
+	// full port name); a spy with an entry here uses it instead of SpyRemap
+	SpyRemapByPort map[string]map[string]int `json:"spy_remap_by_port,omitempty" yaml:"spy_remap_by_port,omitempty"`
+
+	// Note or CC that resets every pad to its initial state, from any input
+	// (0 = none); the CC triggers at values of 64 and up
+	PanicNote int `json:"panic_note,omitempty" yaml:"panic_note,omitempty"`
+	PanicCC   int `json:"panic_cc,omitempty" yaml:"panic_cc,omitempty"`
+
+	// Note or CC that undoes the last pad action (press, long press, scene
+	// recall or panic), from any input (0 = none); the CC triggers at 64 and up
+	UndoNote int `json:"undo_note,omitempty" yaml:"undo_note,omitempty"`
+	UndoCC   int `json:"undo_cc,omitempty" yaml:"undo_cc,omitempty"`
+
+	// Spy device toggles sent as CC: CC number -> pad note
+	// The pad is on while the CC value is at or above SpyCCThreshold (0 = 64)
+	SpyCCRemap     map[string]int `json:"spy_cc_remap,omitempty" yaml:"spy_cc_remap,omitempty"`
+	SpyCCThreshold int            `json:"spy_cc_threshold,omitempty" yaml:"spy_cc_threshold,omitempty"`
 
 	// Control mappings: which amber controls which blues
 	// Key is amber note, value is list of blue notes it controls
-	AmberToBlues map[string][]int `json:"amber_to_blues"`
+	AmberToBlues map[string][]int `json:"amber_to_blues" yaml:"amber_to_blues"`
+
+	// How an amber drives its blues: "opposite" (default) turns them off
+	// while the amber is on (a mute), "same" turns them on with it (an enable)
+	AmberToBluesMode map[string]string `json:"amber_to_blues_mode,omitempty" yaml:"amber_to_blues_mode,omitempty"`
+
+	// Ambers that step the blue above them through a list of colors on each
+	// press instead of controlling blues (e.g. blue, green, red, off)
+	// An amber can't also be an amber_to_blues key
+	AmberToColorCycle map[string][]Color `json:"amber_to_color_cycle,omitempty" yaml:"amber_to_color_cycle,omitempty"`
 
 	// Knob to blue mapping: which CC controls which blue LED
 	// When knob value is 0, blue turns off; when > 3, blue turns on
-	KnobToBlue map[string]int `json:"knob_to_blue"`
+	KnobToBlue map[string]int `json:"knob_to_blue" yaml:"knob_to_blue"`
+
+	// Knobs as buttons: CC -> pad note pressed (toggled, with its amber/blue
+	// and group behaviour) when the CC goes to 64 or above, once per push
+	KnobToToggle map[string]int `json:"knob_to_toggle,omitempty" yaml:"knob_to_toggle,omitempty"`
+
+	// Color picker knobs: CC -> one color channel ("r", "g" or "b") of a
+	// pad's on color, set straight from the knob value (0-127)
+	KnobToChannel map[string]KnobColorChannel `json:"knob_to_channel,omitempty" yaml:"knob_to_channel,omitempty"`
+
+	// Knob smoothing for KnobToBlue (0 = off, below 1): every 10ms a knob's
+	// applied value moves (1 - KnobSmoothing) of the way to its latest raw
+	// value, so the LED eases toward it; higher is smoother but slower
+	KnobSmoothing float64 `json:"knob_smoothing,omitempty" yaml:"knob_smoothing,omitempty"`
+
+	// Knob hysteresis for KnobToBlue: a lit blue turns off below
+	// KnobOffThreshold (0 = 2), an unlit one turns on at or above
+	// KnobOnThreshold (0 = 3)
+	KnobOffThreshold int `json:"knob_off_threshold,omitempty" yaml:"knob_off_threshold,omitempty"`
+	KnobOnThreshold  int `json:"knob_on_threshold,omitempty" yaml:"knob_on_threshold,omitempty"`
+
+	// What a KnobToBlue knob does to its lit pad: "brightness" (default)
+	// scales the on color, "hue" sweeps it around the color wheel
+	KnobMode map[string]string `json:"knob_mode,omitempty" yaml:"knob_mode,omitempty"`
+
+	// KnobToBlue CCs that only preview their pad: lit while the knob is up,
+	// back to the pad's own state once it's turned down, never toggling it
+	KnobMomentary []int `json:"knob_momentary,omitempty" yaml:"knob_momentary,omitempty"`
+
+	// Ignore repeated NoteOns for a held pad until its NoteOff arrives
+	// (some devices send key-repeat NoteOns while a pad is held down)
+	IgnoreNoteRepeat bool `json:"ignore_note_repeat,omitempty" yaml:"ignore_note_repeat,omitempty"`
+
+	// Which source wins for notes driven by both pads and knobs (KnobToBlue)
+	// "" = last change wins, "knob" = knob holds the pad until turned to 0,
+	// "pad" = a pad press holds the pad until the knob is turned back to 0
+	KnobVsPadPriority string `json:"knob_vs_pad_priority,omitempty" yaml:"knob_vs_pad_priority,omitempty"`
+
+	// Knob "comet" sweeps: which CC sweeps a lit head across a whole row
+	// The knob value positions the head; Tail pads behind it fade out
+	KnobComet map[string]KnobComet `json:"knob_comet,omitempty" yaml:"knob_comet,omitempty"`
+
+	// Feedback loop detection: a pad pressed more than LoopMaxPresses times
+	// (0 = 20) within LoopWindowMs (0 = 1000), from any source, is ignored
+	// until it has been quiet for LoopWindowMs
+	LoopMaxPresses int `json:"loop_max_presses,omitempty" yaml:"loop_max_presses,omitempty"`
+	LoopWindowMs   int `json:"loop_window_ms,omitempty" yaml:"loop_window_ms,omitempty"`
+
+	// Presses of the same pad from different sources (LPD8 and spy) within
+	// this many ms count as one press - the first one wins (0 = disabled)
+	PressMergeMs int `json:"press_merge_ms,omitempty" yaml:"press_merge_ms,omitempty"`
+
+	// Per-pad cooldown: pad note -> ms during which further presses of that
+	// pad are ignored after one registers (for mechanically bouncy pads)
+	PadCooldowns map[string]int `json:"pad_cooldowns,omitempty" yaml:"pad_cooldowns,omitempty"`
+
+	// Per-pad "on" colors: pad note -> {"r","g","b"} (0-127), overriding the
+	// row default (blue top, amber bottom)
+	PadColors map[string]Color `json:"pad_colors,omitempty" yaml:"pad_colors,omitempty"`
+
+	// Color temperature knobs: CC -> strength (max channel boost, 0 = 40)
+	// Knob center is neutral; turning up warms lit pads (boosts red),
+	// turning down cools them (boosts blue)
+	KnobColorTemp map[string]int `json:"knob_color_temp,omitempty" yaml:"knob_color_temp,omitempty"`
+
+	// Master brightness (1-127, 0 = 127) scaling every LED, and a knob CC
+	// that sets it live (0 = none)
+	Brightness   int `json:"brightness,omitempty" yaml:"brightness,omitempty"`
+	BrightnessCC int `json:"brightness_cc,omitempty" yaml:"brightness_cc,omitempty"`
+
+	// Gamma correction for knob brightness (knob_to_blue and brightness_cc)
+	// so dimming looks even across the knob's travel (0 = 2.2);
+	// LinearKnobBrightness turns it off for the plain linear scaling
+	KnobGamma            float64 `json:"knob_gamma,omitempty" yaml:"knob_gamma,omitempty"`
+	LinearKnobBrightness bool    `json:"linear_knob_brightness,omitempty" yaml:"linear_knob_brightness,omitempty"`
+
+	// Knob values KnobInMin-KnobInMax map linearly onto knob_to_blue
+	// brightness KnobOutMin-KnobOutMax, before gamma correction (0 max =
+	// 64 in, 127 out, i.e. brightness is twice the knob value)
+	KnobInMin  int `json:"knob_in_min,omitempty" yaml:"knob_in_min,omitempty"`
+	KnobInMax  int `json:"knob_in_max,omitempty" yaml:"knob_in_max,omitempty"`
+	KnobOutMin int `json:"knob_out_min,omitempty" yaml:"knob_out_min,omitempty"`
+	KnobOutMax int `json:"knob_out_max,omitempty" yaml:"knob_out_max,omitempty"`
+
+	// Pad that pulses softly on each quarter note while MIDI clock is being
+	// received, and stays dark otherwise (0 = disabled)
+	// This pad is taken out of the normal toggle/knob mappings
+	ClockIndicatorNote int `json:"clock_indicator_note,omitempty" yaml:"clock_indicator_note,omitempty"`
+
+	// Pad tapped in time to set a tempo that drives the clock indicator and
+	// -clock-sync blinking when there's no MIDI clock (0 = disabled)
+	// This pad is taken out of the normal toggle/knob mappings
+	TapTempoNote int `json:"tap_tempo_note,omitempty" yaml:"tap_tempo_note,omitempty"`
+
+	// Modifier pad: pressing an amber while it's held flips the amber
+	// between opposite and same instead of toggling it (0 = disabled)
+	// This pad is taken out of the normal toggle/knob mappings
+	PolarityToggleNote int `json:"polarity_toggle_note,omitempty" yaml:"polarity_toggle_note,omitempty"`
+
+	// Pad that steps through Palettes, then back to the normal colors
+	// (0 = disabled); it's taken out of the normal toggle/knob mappings
+	PaletteCycleNote int `json:"palette_cycle_note,omitempty" yaml:"palette_cycle_note,omitempty"`
+	// Palettes: on colors for pads 1-8 (bottom row first), one set each
+	Palettes [][8]Color `json:"palettes,omitempty" yaml:"palettes,omitempty"`
+
+	// Press sequencer: hold RecordNote to record pad presses with their
+	// timing (a second press also stops), PlayNote starts/stops looping them
+	// Both are taken out of the normal toggle/knob mappings (0 = disabled)
+	RecordNote int `json:"record_note,omitempty" yaml:"record_note,omitempty"`
+	PlayNote   int `json:"play_note,omitempty" yaml:"play_note,omitempty"`
+
+	// Scale the on-color of spy-pressed pads by the spy press velocity
+	SpyVelocityBrightness bool `json:"spy_velocity_brightness,omitempty" yaml:"spy_velocity_brightness,omitempty"`
+
+	// Brighten a held pad's LED with aftertouch pressure (polyphonic, or
+	// channel aftertouch for the last pad pressed) without changing its state
+	Aftertouch bool `json:"aftertouch,omitempty" yaml:"aftertouch,omitempty"`
+
+	// Scale the on-color of every pressed pad (LPD8 and spy) by the press
+	// velocity - harder presses are brighter
+	VelocitySensitive bool `json:"velocity_sensitive,omitempty" yaml:"velocity_sensitive,omitempty"`
+
+	// Exclusive groups (radio buttons): turning one pad in a group on turns
+	// the others in that group off. A pad can be in at most one group.
+	Groups [][]int `json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	// Host feedback over CC: incoming CC -> pad whose LED follows it
+	// The pad is on while the CC value is at or above the threshold
+	CCFeedback          map[string]int `json:"cc_feedback,omitempty" yaml:"cc_feedback,omitempty"`
+	CCFeedbackChannel   int            `json:"cc_feedback_channel,omitempty" yaml:"cc_feedback_channel,omitempty"`     // 0=all, 1-16
+	CCFeedbackThreshold int            `json:"cc_feedback_threshold,omitempty" yaml:"cc_feedback_threshold,omitempty"` // Default: 64
+
+	// Keystrokes: pad note -> key combination (e.g. "ctrl+shift+a") pressed
+	// whenever that pad turns on
+	KeyMap map[string]string `json:"key_map,omitempty" yaml:"key_map,omitempty"`
+
+	// Program Change pads: pad note -> Program Change sent to another output
+	// each time that pad is pressed
+	PadToProgramChange map[string]ProgramChange `json:"pad_to_program_change,omitempty" yaml:"pad_to_program_change,omitempty"`
+
+	// Minimum ms between LED updates sent to the LPD8; changes in between
+	// are combined into the next update (0 = 10ms)
+	OutputIntervalMs int `json:"output_interval_ms,omitempty" yaml:"output_interval_ms,omitempty"`
+
+	// Turn a pad that was pressed on back off after this many ms unless it
+	// is pressed again first; an amber times out with its blues (0 = never)
+	AutoOffMs int `json:"auto_off_ms,omitempty" yaml:"auto_off_ms,omitempty"`
+
+	// Fade each pad's LED to its new color over this many ms instead of
+	// switching instantly (0 = instant); pad states still change at once
+	FadeMs int `json:"fade_ms,omitempty" yaml:"fade_ms,omitempty"`
+
+	// Pads that blink while on (e.g. cue points), every BlinkMs ms (0 = 500)
+	Blink   []int `json:"blink,omitempty" yaml:"blink,omitempty"`
+	BlinkMs int   `json:"blink_ms,omitempty" yaml:"blink_ms,omitempty"`
+
+	// Pads that blink at their own rate: pad note -> full blink period in ms
+	// (lit for half, dark for half); overrides Blink/BlinkMs for that pad
+	BlinkRates map[string]int `json:"blink_rates,omitempty" yaml:"blink_rates,omitempty"`
+
+	// Scene memory (4 slots of every pad's on/off state): entry i stores or
+	// recalls scene i+1. Store/recall pads are taken out of the normal
+	// toggle/knob mappings (0 = none); store/recall CCs (knob channel)
+	// trigger when the value rises to 64 or above
+	SceneStore    []int `json:"scene_store,omitempty" yaml:"scene_store,omitempty"`
+	SceneRecall   []int `json:"scene_recall,omitempty" yaml:"scene_recall,omitempty"`
+	SceneStoreCC  []int `json:"scene_store_cc,omitempty" yaml:"scene_store_cc,omitempty"`
+	SceneRecallCC []int `json:"scene_recall_cc,omitempty" yaml:"scene_recall_cc,omitempty"`
+
+	// Long press: pad note -> action run instead of the normal press once
+	// the pad is held for LongPressMs (0 = 500): "all-off",
+	// "store-scene-N" or "recall-scene-N". Quick taps act on release.
+	LongPress   map[string]string `json:"long_press,omitempty" yaml:"long_press,omitempty"`
+	LongPressMs int               `json:"long_press_ms,omitempty" yaml:"long_press_ms,omitempty"`
+
+	// Double tap: pad note -> action run instead of the normal press when
+	// the pad is pressed twice within DoubleTapMs (0 = 300): "solo" (this
+	// pad on, the rest of its row off) or a long_press action. Single taps
+	// toggle once the window has passed.
+	DoubleTap   map[string]string `json:"double_tap,omitempty" yaml:"double_tap,omitempty"`
+	DoubleTapMs int               `json:"double_tap_ms,omitempty" yaml:"double_tap_ms,omitempty"`
+
+	// With -state, save pad states at most every AutoSaveSec seconds while
+	// they change, and on exit (0 = save on every change)
+	AutoSaveSec int `json:"auto_save_sec,omitempty" yaml:"auto_save_sec,omitempty"`
+
+	// With -state, save the pads as they were before a blackout while the
+	// grid is still dark from it, so a blackout doesn't lose the layout
+	SavePreBlackoutState bool `json:"save_pre_blackout_state,omitempty" yaml:"save_pre_blackout_state,omitempty"`
+
+	// Fade time knobs: CC -> longest fade in ms (0 = 1000); the knob sets
+	// the fade_ms used by every pad from 0 up to it, live
+	KnobFadeTime map[string]int `json:"knob_fade_time,omitempty" yaml:"knob_fade_time,omitempty"`
+
+	// Momentary pads released with a Note Off velocity flash at that
+	// brightness briefly before going dark
+	UseReleaseVelocity bool `json:"use_release_velocity,omitempty" yaml:"use_release_velocity,omitempty"`
+
+	// Minimum ms between WebSocket state messages to each client; changes
+	// in between are combined into the latest state (0 = one per frame)
+	BroadcastMs int `json:"broadcast_ms,omitempty" yaml:"broadcast_ms,omitempty"`
+
+	// Per-channel on colors: MIDI channel ("1"-"16") -> the color pads
+	// pressed from it light in, after pad_colors but before the row default
+	ChannelColors map[string]Color `json:"channel_colors,omitempty" yaml:"channel_colors,omitempty"`
+
+	// Flash every pad red briefly when a config reload is rejected, then
+	// go back to the grid as it was
+	ReloadErrorFlash bool `json:"reload_error_flash,omitempty" yaml:"reload_error_flash,omitempty"`
+
+	// Scene slot (1-4, 0 = off) recalled while channel aftertouch is at or
+	// above AftertouchSceneThreshold (0 = 100); easing off restores the pads
+	AftertouchScene          int `json:"aftertouch_scene,omitempty" yaml:"aftertouch_scene,omitempty"`
+	AftertouchSceneThreshold int `json:"aftertouch_scene_threshold,omitempty" yaml:"aftertouch_scene_threshold,omitempty"`
+
+	// Split pads: pad note -> two colors the pad swaps between rapidly
+	// while on, so it reads as a blend of both
+	SplitPads map[string][2]Color `json:"split_pads,omitempty" yaml:"split_pads,omitempty"`
+}
+
+// KnobComet sweeps a lit head with a fading tail across one row
+type KnobComet struct {
+	Row  string `json:"row" yaml:"row"`   // "top" or "bottom"
+	Tail int    `json:"tail" yaml:"tail"` // Number of trailing pads behind the head (0-3)
+}
+
+// KnobColorChannel is the pad color channel a knob sets
+type KnobColorChannel struct {
+	Note    int    `json:"note" yaml:"note"`       // Pad note
+	Channel string `json:"channel" yaml:"channel"` // "r", "g" or "b"
+}
+
+// ProgramChange is sent to Port when its pad is pressed
+type ProgramChange struct {
+	Port    string `json:"port" yaml:"port"`       // MIDI output port name
+	Program int    `json:"program" yaml:"program"` // Program number (0-127)
+	Channel int    `json:"channel" yaml:"channel"` // MIDI channel (1-16)
 }
 
 // Default configuration
@@ -51,10 +334,10 @@ func defaultConfig() Config {
 	}
 
 	cfg.AmberToBlues = map[string][]int{
-		"36": {40},           // Pad 1 controls Pad 5
-		"37": {41, 42, 43},   // Pad 2 controls Pads 6, 7, 8
-		"38": {41, 42, 43},   // Pad 3 controls Pads 6, 7, 8
-		"39": {43},           // Pad 4 controls Pad 8
+		"36": {40},         // Pad 1 controls Pad 5
+		"37": {41, 42, 43}, // Pad 2 controls Pads 6, 7, 8
+		"38": {41, 42, 43}, // Pad 3 controls Pads 6, 7, 8
+		"39": {43},         // Pad 4 controls Pad 8
 	}
 
 	cfg.KnobToBlue = map[string]int{
@@ -67,24 +350,95 @@ func defaultConfig() Config {
 	return cfg
 }
 
+// Load and validate a config file
 func loadConfig(path string) (Config, error) {
-	data, err := os.ReadFile(path)
+	cfg, err := readConfig(path)
 	if err != nil {
 		return Config{}, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	if err := validateConfig(cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Parse a config file without validating it
+func readConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
 		return Config{}, err
 	}
 
+	var cfg Config
+	if isYAMLPath(path) {
+		err = yaml.Unmarshal(data, &cfg)
+	} else {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
 	return cfg, nil
 }
 
+// Default config locations, searched in order when -config isn't given
+func configSearchPaths() []string {
+	paths := []string{"config.json"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "lpd8-led-bridge", "config.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "lpd8-led-bridge", "config.json"))
+	}
+	paths = append(paths, "/etc/lpd8-led-bridge/config.json")
+	return paths
+}
+
+// Find the first config file on the search path ("" if none exist)
+func findConfig() string {
+	seen := make(map[string]bool)
+	for _, path := range configSearchPaths() {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		debugLog("No config at %s", path)
+	}
+	return ""
+}
+
+// Whether a config path is YAML (.yaml/.yml), else JSON
+func isYAMLPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// Write a config as YAML or JSON, depending on the path's extension
 func saveConfig(path string, cfg Config) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return err
+	var data []byte
+	if isYAMLPath(path) {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(cfg); err != nil {
+			return err
+		}
+		enc.Close()
+		data = buf.Bytes()
+	} else {
+		var err error
+		data, err = json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return err
+		}
 	}
 	return os.WriteFile(path, data, 0644)
 }
@@ -121,6 +475,14 @@ func buildMappings(cfg Config) {
 		amberToBlues[uint8(note)] = bluesU8
 	}
 
+	// Rebuild amberSameMode
+	amberSameMode = make(map[uint8]bool)
+	for noteStr, mode := range cfg.AmberToBluesMode {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		amberSameMode[uint8(note)] = mode == amberModeSame
+	}
+
 	// Rebuild blueToAmbers (reverse mapping)
 	blueToAmbers = make(map[uint8][]uint8)
 	for amber, blues := range amberToBlues {
@@ -136,6 +498,32 @@ func buildMappings(cfg Config) {
 		fmt.Sscanf(noteStr, "%d", &note)
 		crss12NoteRemap[uint8(note)] = uint8(mapped)
 	}
+	spyRemapByPort = make(map[string]map[uint8]uint8)
+	for port, remap := range cfg.SpyRemapByPort {
+		spyRemapByPort[port] = make(map[uint8]uint8)
+		for noteStr, mapped := range remap {
+			var note int
+			fmt.Sscanf(noteStr, "%d", &note)
+			spyRemapByPort[port][uint8(note)] = uint8(mapped)
+		}
+	}
+
+	// Rebuild spyCCRemap
+	spyCCRemap = make(map[uint8]uint8)
+	for ccStr, note := range cfg.SpyCCRemap {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		spyCCRemap[uint8(cc)] = uint8(note)
+	}
+	panicNote = uint8(cfg.PanicNote)
+	panicCC = uint8(cfg.PanicCC)
+	undoNote = uint8(cfg.UndoNote)
+	undoCC = uint8(cfg.UndoCC)
+	undoHistory = nil // Snapshots are of the old mappings
+	spyCCThreshold = 64
+	if cfg.SpyCCThreshold > 0 {
+		spyCCThreshold = uint8(cfg.SpyCCThreshold)
+	}
 
 	// Rebuild knobToBlue
 	knobToBlue = make(map[uint8]uint8)
@@ -145,42 +533,431 @@ func buildMappings(cfg Config) {
 		knobToBlue[uint8(cc)] = uint8(blueNote)
 	}
 
+	// Rebuild knobToToggle
+	knobToToggle = make(map[uint8]uint8)
+	for ccStr, note := range cfg.KnobToToggle {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		knobToToggle[uint8(cc)] = uint8(note)
+	}
+
+	// Rebuild knobToChannel; picked colors go back to the configured ones
+	knobToChannel = make(map[uint8]KnobColorChannel)
+	for ccStr, target := range cfg.KnobToChannel {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		knobToChannel[uint8(cc)] = target
+	}
+	pickedColors = make(map[uint8]Color)
+
 	// Store channels (convert 1-16 to 0-15, 0 stays 0 for "all")
-	lpd8Channel = uint8(cfg.LPD8.Channel - 1)
+	if cfg.LPD8.Channel == 0 {
+		lpd8Channel = 255 // Special value meaning "accept all channels"
+	} else {
+		lpd8Channel = uint8(cfg.LPD8.Channel - 1)
+	}
 	if cfg.LPD8.KnobChannel == 0 {
 		lpd8KnobChannel = 255 // Special value meaning "accept all channels"
 	} else {
 		lpd8KnobChannel = uint8(cfg.LPD8.KnobChannel - 1)
 	}
+
+	// Scene controls -> slot
+	sceneStoreNotes = sceneSlots(cfg.SceneStore)
+	sceneRecallNotes = sceneSlots(cfg.SceneRecall)
+	sceneStoreCCs = sceneSlots(cfg.SceneStoreCC)
+	sceneRecallCCs = sceneSlots(cfg.SceneRecallCC)
+
+	// Reserve special pads (clock indicator, sequencer record/play, scene
+	// store/recall) - they only show their own feature's state, so drop
+	// them as amber/knob targets
+	clockIndicatorNote = uint8(cfg.ClockIndicatorNote)
+	recordNote = uint8(cfg.RecordNote)
+	playNote = uint8(cfg.PlayNote)
+	if cfg.TapTempoNote == 0 && tapTempoNote != 0 {
+		resetTapTempo()
+	}
+	tapTempoNote = uint8(cfg.TapTempoNote)
+	if uint8(cfg.PolarityToggleNote) != polarityToggleNote {
+		polarityHeld = false
+	}
+	polarityToggleNote = uint8(cfg.PolarityToggleNote)
+	paletteCycleNote = uint8(cfg.PaletteCycleNote)
+	reservedPads = make(map[uint8]bool)
+	for _, note := range []uint8{clockIndicatorNote, recordNote, playNote, tapTempoNote, polarityToggleNote, paletteCycleNote} {
+		if note != 0 {
+			reservedPads[note] = true
+		}
+	}
+	for note := range sceneStoreNotes {
+		reservedPads[note] = true
+	}
+	for note := range sceneRecallNotes {
+		reservedPads[note] = true
+	}
+	for amber, blues := range amberToBlues {
+		kept := blues[:0]
+		for _, blue := range blues {
+			if !reservedPads[blue] {
+				kept = append(kept, blue)
+			}
+		}
+		amberToBlues[amber] = kept
+	}
+	for cc, blue := range knobToBlue {
+		if reservedPads[blue] {
+			delete(knobToBlue, cc)
+		}
+	}
+	for cc, target := range knobToChannel {
+		if reservedPads[uint8(target.Note)] {
+			delete(knobToChannel, cc)
+		}
+	}
+	buildColorCycles(cfg)
+	applyAmberPolarityLocked()
+
+	// Rebuild ccFeedback
+	ccFeedback = make(map[uint8]uint8)
+	for ccStr, note := range cfg.CCFeedback {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		ccFeedback[uint8(cc)] = uint8(note)
+	}
+	if cfg.CCFeedbackChannel == 0 {
+		ccFeedbackChannel = 255 // Accept all channels
+	} else {
+		ccFeedbackChannel = uint8(cfg.CCFeedbackChannel - 1)
+	}
+	ccFeedbackThreshold = 64
+	if cfg.CCFeedbackThreshold > 0 {
+		ccFeedbackThreshold = uint8(cfg.CCFeedbackThreshold)
+	}
+
+	// Rebuild keyMap (invalid combinations are rejected by validateConfig)
+	keyMap = make(map[uint8]keyCombo)
+	for noteStr, keys := range cfg.KeyMap {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		combo, err := parseKeyCombo(keys)
+		if err != nil {
+			log.Printf("Warning: key_map pad %d: %v, ignoring", note, err)
+			continue
+		}
+		keyMap[uint8(note)] = combo
+	}
+
+	// Rebuild padToProgramChange
+	padToProgramChange = make(map[uint8]programChange)
+	for noteStr, pc := range cfg.PadToProgramChange {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		padToProgramChange[uint8(note)] = programChange{
+			port:    pc.Port,
+			program: uint8(min(max(pc.Program, 0), 127)),
+			channel: uint8(min(max(pc.Channel, 1), 16) - 1),
+		}
+	}
+
+	// Rebuild longPressActions (invalid actions are rejected by validateConfig)
+	longPressActions = make(map[uint8]longPressAction)
+	for noteStr, s := range cfg.LongPress {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		action, err := parseLongPressAction(s)
+		if err != nil {
+			log.Printf("Warning: long_press pad %d: %v, ignoring", note, err)
+			continue
+		}
+		longPressActions[uint8(note)] = action
+	}
+	longPressThreshold = defaultLongPressThreshold
+	if cfg.LongPressMs > 0 {
+		longPressThreshold = time.Duration(cfg.LongPressMs) * time.Millisecond
+	}
+
+	// Rebuild doubleTapActions (invalid actions are rejected by validateConfig)
+	doubleTapActions = make(map[uint8]longPressAction)
+	for noteStr, s := range cfg.DoubleTap {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		action, err := parseDoubleTapAction(s)
+		if err != nil {
+			log.Printf("Warning: double_tap pad %d: %v, ignoring", note, err)
+			continue
+		}
+		doubleTapActions[uint8(note)] = action
+	}
+	doubleTapWindow = defaultDoubleTapWindow
+	if cfg.DoubleTapMs > 0 {
+		doubleTapWindow = time.Duration(cfg.DoubleTapMs) * time.Millisecond
+	}
+
+	// Rebuild blinkPads (half-periods); every pad restarts its blink lit
+	blinkInterval := defaultBlinkInterval
+	if cfg.BlinkMs > 0 {
+		blinkInterval = time.Duration(cfg.BlinkMs) * time.Millisecond
+	}
+	blinkPads = make(map[uint8]time.Duration)
+	for _, note := range cfg.Blink {
+		blinkPads[uint8(note)] = blinkInterval
+	}
+	for noteStr, period := range cfg.BlinkRates {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		blinkPads[uint8(note)] = time.Duration(period) * time.Millisecond / 2
+	}
+	blinkPhaseOff = make(map[uint8]bool)
+	blinkNext = make(map[uint8]time.Time)
+
+	// Rebuild splitPads, clamping channels to 0-127
+	splitPads = make(map[uint8][2]Color)
+	for noteStr, pair := range cfg.SplitPads {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		for i, c := range pair {
+			pair[i] = Color{R: min(c.R, 127), G: min(c.G, 127), B: min(c.B, 127)}
+		}
+		splitPads[uint8(note)] = pair
+	}
+
+	// Rebuild padGroup (note -> the other pads in its group)
+	padGroup = make(map[uint8][]uint8)
+	for _, group := range cfg.Groups {
+		for _, note := range group {
+			for _, other := range group {
+				if other != note {
+					padGroup[uint8(note)] = append(padGroup[uint8(note)], uint8(other))
+				}
+			}
+		}
+	}
+
+	// Rebuild momentaryPads
+	momentaryPads = make(map[uint8]bool)
+	for _, note := range cfg.LPD8.Momentary {
+		momentaryPads[uint8(note)] = true
+	}
+
+	// Rebuild initialState
+	initialState = make(map[uint8]bool)
+	for noteStr, on := range cfg.InitialState {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		initialState[uint8(note)] = on
+	}
+
+	// Rebuild noteToColor, clamping channels to 0-127
+	noteToColor = make(map[uint8]Color)
+	for noteStr, c := range cfg.PadColors {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		noteToColor[uint8(note)] = Color{R: min(c.R, 127), G: min(c.G, 127), B: min(c.B, 127)}
+	}
+	buildChannelColors(cfg)
+
+	// Rebuild palettes, clamping channels to 0-127; a palette that's gone
+	// falls back to the normal colors
+	palettes = make([][8]Color, len(cfg.Palettes))
+	for i, palette := range cfg.Palettes {
+		for pos, c := range palette {
+			palettes[i][pos] = Color{R: min(c.R, 127), G: min(c.G, 127), B: min(c.B, 127)}
+		}
+	}
+	if paletteIndex > len(palettes) || paletteCycleNote == 0 {
+		paletteIndex = 0
+	}
+
+	// Rebuild knobMode
+	knobMode = make(map[uint8]string)
+	for ccStr, mode := range cfg.KnobMode {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		knobMode[uint8(cc)] = mode
+	}
+
+	// Rebuild knobMomentary; previews end with the old mappings
+	knobMomentary = make(map[uint8]bool)
+	for _, cc := range cfg.KnobMomentary {
+		knobMomentary[uint8(cc)] = true
+	}
+	knobPreview = make(map[uint8]Color)
+
+	// Knob hysteresis thresholds; knobs re-learn their state after a reload
+	knobOffThreshold = 2
+	if cfg.KnobOffThreshold > 0 {
+		knobOffThreshold = uint8(cfg.KnobOffThreshold)
+	}
+	knobOnThreshold = 3
+	if cfg.KnobOnThreshold > 0 {
+		knobOnThreshold = uint8(cfg.KnobOnThreshold)
+	}
+	knobOnThreshold = max(knobOnThreshold, knobOffThreshold)
+	knobSmoothing = cfg.KnobSmoothing
+	knobOn = make(map[uint8]bool)
+
+	// Rebuild knobColorTemp
+	knobColorTemp = make(map[uint8]int)
+	for ccStr, strength := range cfg.KnobColorTemp {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		if strength <= 0 {
+			strength = 40
+		}
+		knobColorTemp[uint8(cc)] = strength
+	}
+
+	// Rebuild knobFadeTime
+	knobFadeTime = make(map[uint8]time.Duration)
+	for ccStr, maxMs := range cfg.KnobFadeTime {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		if maxMs <= 0 {
+			maxMs = defaultKnobFadeMax
+		}
+		knobFadeTime[uint8(cc)] = time.Duration(maxMs) * time.Millisecond
+	}
+
+	masterBrightness = 127
+	if cfg.Brightness > 0 {
+		masterBrightness = uint8(cfg.Brightness)
+	}
+	brightnessCC = uint8(cfg.BrightnessCC)
+	switch {
+	case cfg.LinearKnobBrightness:
+		knobGammaTable = lpd8.GammaTable(1)
+	case cfg.KnobGamma > 0:
+		knobGammaTable = lpd8.GammaTable(cfg.KnobGamma)
+	default:
+		knobGammaTable = lpd8.GammaTable(defaultKnobGamma)
+	}
+	knobInRange, knobOutRange = knobRanges(cfg)
+
+	// Rebuild padCooldowns
+	padCooldowns = make(map[uint8]time.Duration)
+	for noteStr, ms := range cfg.PadCooldowns {
+		var note int
+		fmt.Sscanf(noteStr, "%d", &note)
+		padCooldowns[uint8(note)] = time.Duration(ms) * time.Millisecond
+	}
+
+	// Rebuild knobComet
+	knobComet = make(map[uint8]cometSweep)
+	for ccStr, comet := range cfg.KnobComet {
+		var cc int
+		fmt.Sscanf(ccStr, "%d", &cc)
+		var sweep cometSweep
+		switch comet.Row {
+		case "top":
+			sweep.color = colorTopRow
+			for i, note := range cfg.LPD8.TopRow {
+				sweep.notes[i] = uint8(note)
+			}
+		case "bottom":
+			sweep.color = colorBottomRow
+			for i, note := range cfg.LPD8.BottomRow {
+				sweep.notes[i] = uint8(note)
+			}
+		default:
+			log.Printf("Warning: knob_comet CC %d has unknown row %q, ignoring", cc, comet.Row)
+			continue
+		}
+		sweep.tail = min(max(comet.Tail, 0), 3)
+		knobComet[uint8(cc)] = sweep
+	}
+
+	ignoreNoteRepeat = cfg.IgnoreNoteRepeat
+	spyVelocityBrightness = cfg.SpyVelocityBrightness
+	velocitySensitive = cfg.VelocitySensitive
+	aftertouchEnabled = cfg.Aftertouch
+	if cfg.AftertouchScene-1 != pressureScene {
+		pressureSceneSaved = nil // A different scene (or none) now; keep the pads as they are
+	}
+	pressureScene = cfg.AftertouchScene - 1
+	pressureSceneThreshold = defaultPressureSceneThreshold
+	if cfg.AftertouchSceneThreshold > 0 {
+		pressureSceneThreshold = uint8(cfg.AftertouchSceneThreshold)
+	}
+	if !aftertouchEnabled {
+		padPressure = make(map[uint8]uint8)
+		lastHeldPad = make(map[string]uint8)
+	}
+	pressMergeWindow = time.Duration(cfg.PressMergeMs) * time.Millisecond
+	loopMaxPresses = defaultLoopMaxPresses
+	if cfg.LoopMaxPresses > 0 {
+		loopMaxPresses = cfg.LoopMaxPresses
+	}
+	loopWindow = defaultLoopWindow
+	if cfg.LoopWindowMs > 0 {
+		loopWindow = time.Duration(cfg.LoopWindowMs) * time.Millisecond
+	}
+	fadeDuration = time.Duration(cfg.FadeMs) * time.Millisecond
+	useReleaseVelocity = cfg.UseReleaseVelocity
+	broadcastInterval = time.Duration(cfg.BroadcastMs) * time.Millisecond
+	reloadErrorFlash = cfg.ReloadErrorFlash
+	autoSaveInterval = time.Duration(cfg.AutoSaveSec) * time.Second
+	savePreBlackout = cfg.SavePreBlackoutState
+	if !savePreBlackout {
+		preBlackoutState = nil
+	}
+	autoOffDelay = time.Duration(cfg.AutoOffMs) * time.Millisecond
+	frameInterval = defaultFrameInterval
+	if cfg.OutputIntervalMs > 0 {
+		frameInterval = time.Duration(cfg.OutputIntervalMs) * time.Millisecond
+	}
+
+	// Resolve knob vs pad priority for notes driven by both
+	switch cfg.KnobVsPadPriority {
+	case "", sourceKnob, sourcePad:
+		knobVsPadPriority = cfg.KnobVsPadPriority
+	default:
+		log.Printf("Warning: unknown knob_vs_pad_priority %q, using last change wins", cfg.KnobVsPadPriority)
+		knobVsPadPriority = ""
+	}
+	padSource = make(map[uint8]string)
 }
 
-var lpd8Channel uint8 = 9       // Default channel 10 (0-indexed) for pads
-var lpd8KnobChannel uint8 = 255 // Default: accept all channels for knobs
-var debugMode bool = false      // Debug logging
+var lpd8Channel uint8 = 9          // Default channel 10 (0-indexed) for pads, 255 = all
+var lpd8KnobChannel uint8 = 255    // Default: accept all channels for knobs
+var debugMode bool = false         // Debug logging
+var dryRun bool                    // Print MIDI output instead of sending it
+var ignoreNoteRepeat bool          // Suppress key-repeat NoteOns while a pad is held
+var knobVsPadPriority string       // "", "knob" or "pad" (see Config.KnobVsPadPriority)
+var pressMergeWindow time.Duration // Cross-source press merge window (0 = off)
+var spyVelocityBrightness bool     // Scale spy-pressed pad colors by velocity
+var velocitySensitive bool         // Scale all pressed pad colors by velocity
+
+// Whether a pad message on channel ch (0-15) is for the LPD8's pads
+func isPadChannel(ch uint8) bool {
+	return lpd8Channel == 255 || ch == lpd8Channel
+}
 
 func debugLog(format string, v ...interface{}) {
-	if debugMode {
-		log.Printf(format, v...)
+	if !debugMode {
+		return
+	}
+	if jsonLogger != nil {
+		logJSON(slog.LevelDebug, fmt.Sprintf(format, v...))
+		return
 	}
+	log.Printf(format, v...)
 }
 
 // LPD8 MK2 SysEx for LED control
 // Format: F0 47 7F 4C 06 00 30 [48 bytes] F7
 // Product ID = 0x4C (not 0x30)
 // Each color channel is 2 bytes: [high=0x00, low=value]
-// So each pad = 6 bytes, 8 pads = 48 bytes
-var sysExHeader = []byte{0xF0, 0x47, 0x7F, 0x4C, 0x06, 0x00, 0x30}
-var sysExFooter = []byte{0xF7}
+// So each pad = 6 bytes, 8 pads = 48 bytes (see pkg/lpd8)
+var sysExHeader = lpd8.SysExHeader
+var sysExFooter = lpd8.SysExFooter
 
 // Pad colors (RGB values 0-127)
-type Color struct {
-	R, G, B byte
-}
+type Color = lpd8.Color
 
 var (
-	colorOff       = Color{0, 0, 0}       // LED off (black)
-	colorTopRow    = Color{0, 0, 127}     // Blue for top row (stem on/off)
-	colorBottomRow = Color{127, 40, 0}    // Amber for bottom row (FX)
+	colorOff       = lpd8.Off   // LED off (black)
+	colorTopRow    = lpd8.Blue  // Blue for top row (stem on/off)
+	colorBottomRow = lpd8.Amber // Amber for bottom row (FX)
 )
 
 // Runtime mappings (rebuilt from config)
@@ -188,9 +965,41 @@ var noteToPayloadPos = map[uint8]int{}
 var isTopRow = map[uint8]bool{}
 var amberToBlues = map[uint8][]uint8{}
 var blueToAmbers = map[uint8][]uint8{}
+var amberSameMode = map[uint8]bool{} // Ambers whose blues follow them (amberModeSame)
 var crss12NoteRemap = map[uint8]uint8{}
+var spyRemapByPort = map[string]map[uint8]uint8{}
+var spyCCRemap = map[uint8]uint8{} // Spy CC -> pad note
 var knobToBlue = map[uint8]uint8{} // CC number -> blue note
-
+var knobComet = map[uint8]cometSweep{}
+var ccFeedback = map[uint8]uint8{}  // Host feedback CC -> pad note
+var reservedPads = map[uint8]bool{} // Pads owned by a feature, not toggled by presses
+var padCooldowns = map[uint8]time.Duration{}
+var noteToColor = map[uint8]Color{}  // Pad note -> configured on color
+var momentaryPads = map[uint8]bool{} // Pads lit only while held
+var initialState = map[uint8]bool{}  // Pad note -> on at startup (see initialPadOn)
+var padGroup = map[uint8][]uint8{}   // Pad note -> other pads in its exclusive group
+var knobColorTemp = map[uint8]int{}  // CC -> color temperature strength
+var knobOn = map[uint8]bool{}        // KnobToBlue CC -> whether it last turned its blue on
+var knobMode = map[uint8]string{}    // KnobToBlue CC -> knobModeBrightness or knobModeHue
+var knobMomentary = map[uint8]bool{} // KnobToBlue CCs that preview instead of latching
+var knobPreview = map[uint8]Color{}  // Pad note -> color shown by a momentary knob (guarded by stateMutex)
+var ccFeedbackChannel uint8 = 255    // 255 = accept all channels
+var ccFeedbackThreshold uint8 = 64   // CC value at/above which the pad is on
+var spyCCThreshold uint8 = 64        // Spy CC value at/above which its pad is on
+var knobOffThreshold uint8 = 2       // KnobToBlue value below which a lit blue turns off
+var knobOnThreshold uint8 = 3        // KnobToBlue value at/above which an unlit blue turns on
+var knobSmoothing float64            // KnobToBlue smoothing factor (0 = off)
+
+// Color picker knobs, and the on colors they have set (guarded by stateMutex)
+var knobToChannel = map[uint8]KnobColorChannel{}
+var pickedColors = map[uint8]Color{}
+
+// A row swept by a comet knob
+type cometSweep struct {
+	notes [4]uint8 // Row notes, in sweep order
+	color Color    // Head color
+	tail  int      // Trailing pads behind the head
+}
 
 // Current LED colors for each pad position
 var padColors [8]Color
@@ -199,104 +1008,414 @@ var padColors [8]Color
 var padState = make(map[uint8]bool)
 var stateMutex sync.Mutex
 
-// Global send function (set after opening output port)
-var sendSysEx func([]byte) error
+// Guards the mappings buildMappings fills in from config. applyConfig swaps
+// them holding it for writing; each MIDI message, HTTP or OSC request, timer
+// and goroutine that reads them holds it for reading. Taken before
+// stateMutex and never recursively, as a read lock waiting behind a
+// reload's write lock deadlocks.
+var mappingsMutex sync.RWMutex
+
+// Track held pads per source (NoteOn seen, no NoteOff yet) for repeat suppression
+type heldKey struct {
+	source string
+	note   uint8
+}
 
-// Build payload (48 bytes: 6 per pad)
-// Each color channel is 2 bytes: [high=0x00, low=value]
-func buildPayload(colors [8]Color) []byte {
-	payload := make([]byte, 0, 48)
-	for _, c := range colors {
-		// R: high byte (always 0), low byte (value)
-		payload = append(payload, 0x00, c.R)
-		// G: high byte (always 0), low byte (value)
-		payload = append(payload, 0x00, c.G)
-		// B: high byte (always 0), low byte (value)
-		payload = append(payload, 0x00, c.B)
+var heldNotes = make(map[heldKey]bool)
+var heldMutex sync.Mutex
+
+// Register a NoteOn for a pad; returns false if it's a repeat of a held pad
+// that should be ignored
+func notePressed(source string, note uint8) bool {
+	if !ignoreNoteRepeat {
+		return true
+	}
+
+	heldMutex.Lock()
+	defer heldMutex.Unlock()
+
+	key := heldKey{source, note}
+	if heldNotes[key] {
+		debugLog("%s note %d repeated while held, ignoring", source, note)
+		return false
 	}
-	return payload
+	heldNotes[key] = true
+	return true
 }
 
-// Build complete SysEx message
-func buildSysEx(colors [8]Color) []byte {
-	payload := buildPayload(colors)
-	msg := make([]byte, 0, 64)
-	msg = append(msg, sysExHeader...)
-	msg = append(msg, payload...)
-	msg = append(msg, sysExFooter...)
-	return msg
+// Remap a spy device note to its LPD8 note (unmapped notes pass through)
+func spyNote(remap map[uint8]uint8, note uint8) uint8 {
+	if remapped, ok := remap[note]; ok {
+		return remapped
+	}
+	return note
 }
 
-// Toggle a pad's LED state and send update
-func togglePad(note uint8) {
+// Note remap for a spy port: its spy_remap_by_port entry under any of its
+// names, or spy_remap
+func spyRemapFor(names ...string) map[uint8]uint8 {
+	for _, name := range names {
+		if remap, ok := spyRemapByPort[name]; ok {
+			return remap
+		}
+	}
+	return crss12NoteRemap
+}
+
+// Press source for a spy port, so presses from different spies are told
+// apart like the LPD8's and a spy's are
+func spySource(name string) string {
+	return "spy " + name
+}
+
+func isSpySource(source string) bool {
+	return strings.HasPrefix(source, "spy ")
+}
+
+// Check whether a pad is currently on
+func padIsOn(note uint8) bool {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
+	return padState[note]
+}
 
-	pos, ok := noteToPayloadPos[note]
-	if !ok {
-		return
-	}
+// Last accepted press per pad, for merging presses across sources
+type pressRecord struct {
+	source string
+	at     time.Time
+}
 
-	// Toggle the state
-	padState[note] = !padState[note]
-	isOn := padState[note]
+var lastPress = make(map[uint8]pressRecord)
+var pressMutex sync.Mutex
 
-	// Determine color based on state and row
-	var newColor Color
-	var colorName string
-	if isOn {
-		if isTopRow[note] {
-			newColor = colorTopRow // Blue
-			colorName = "BLUE"
-		} else {
-			newColor = colorBottomRow // Amber
-			colorName = "AMBER"
-		}
-	} else {
-		newColor = colorOff
-		colorName = "OFF"
+// Decide whether a press should be handled or merged into a press of the same
+// pad that just arrived from another source. Resolution rule: within the merge
+// window the first press wins and later presses from other sources are dropped,
+// so near-simultaneous presses on both devices always give exactly one toggle.
+func acceptPress(source string, note uint8) bool {
+	if pressMergeWindow <= 0 {
+		return true
 	}
 
-	padColors[pos] = newColor
+	pressMutex.Lock()
+	defer pressMutex.Unlock()
 
-	// Send SysEx update
-	sysex := buildSysEx(padColors)
-	if err := sendSysEx(sysex); err != nil {
-		log.Printf("Error sending SysEx: %v", err)
-		return
+	now := time.Now()
+	if last, ok := lastPress[note]; ok && last.source != source && now.Sub(last.at) < pressMergeWindow {
+		debugLog("%s press of %d merged into %s press %v ago", source, note, last.source, now.Sub(last.at))
+		return false
 	}
-
-	debugLog("Pad %d toggled -> %s", note, colorName)
+	lastPress[note] = pressRecord{source, now}
+	return true
 }
 
-// Set a pad's LED state directly (not toggle)
-func setPad(note uint8, on bool) {
+// When each pad's cooldown ends (guarded by stateMutex)
+var cooldownUntil = make(map[uint8]time.Time)
+
+// Check a pad's cooldown; returns false if the press falls inside it,
+// otherwise starts a new cooldown for the pad
+func padCooledDown(note uint8) bool {
+	cooldown, ok := padCooldowns[note]
+	if !ok || cooldown <= 0 {
+		return true
+	}
+
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 
-	pos, ok := noteToPayloadPos[note]
-	if !ok {
-		return
+	now := time.Now()
+	if now.Before(cooldownUntil[note]) {
+		debugLog("Pad %d in cooldown for %v, ignoring", note, cooldownUntil[note].Sub(now))
+		return false
 	}
+	cooldownUntil[note] = now.Add(cooldown)
+	return true
+}
 
-	// Skip if already in desired state
-	if padState[note] == on {
-		return
+// Debounce: a second press of the same pad from the same source within this
+// window is dropped (-debounce, 0 = disabled)
+var debounceWindow = 50 * time.Millisecond
+
+type debounceRecord struct {
+	ts int32     // MIDI timestamp of the press (ms since the port opened, 0 = none)
+	at time.Time // Wall clock time of the press
+}
+
+var lastDebounce = make(map[heldKey]debounceRecord)
+var debounceMutex sync.Mutex
+
+// Check a press against the debounce window; returns false for a rapid
+// repeat of the same pad from the same source
+// ts is the handler's timestampms; when either press lacks one, or it went
+// backwards (the port was reopened), the wall clock is used instead
+func debounced(source string, note uint8, ts int32) bool {
+	if debounceWindow <= 0 {
+		return true
 	}
 
-	padState[note] = on
+	debounceMutex.Lock()
+	defer debounceMutex.Unlock()
 
-	// Determine color based on state and row
-	var newColor Color
-	var colorName string
-	if on {
-		if isTopRow[note] {
-			newColor = colorTopRow // Blue
-			colorName = "BLUE"
+	key := heldKey{source, note}
+	now := time.Now()
+	last, ok := lastDebounce[key]
+	lastDebounce[key] = debounceRecord{ts, now}
+	if !ok {
+		return true
+	}
+
+	elapsed := now.Sub(last.at)
+	if ts > 0 && last.ts > 0 && ts >= last.ts {
+		elapsed = time.Duration(ts-last.ts) * time.Millisecond
+	}
+	if elapsed < debounceWindow {
+		debugLog("%s press of %d %v after the last one, debounced", source, note, elapsed)
+		return false
+	}
+	return true
+}
+
+// Register a NoteOff (or NoteOn with velocity 0) releasing a held pad
+func noteReleased(source string, note uint8) {
+	heldMutex.Lock()
+	defer heldMutex.Unlock()
+
+	delete(heldNotes, heldKey{source, note})
+}
+
+// Sources that can set a pad, for knob vs pad priority
+const (
+	sourcePad  = "pad"
+	sourceKnob = "knob"
+)
+
+// Last source that set each pad (guarded by stateMutex)
+var padSource = make(map[uint8]string)
+
+// Check whether a pad press may change a note under the knob vs pad priority
+// Caller must hold stateMutex
+func padMayChange(note uint8) bool {
+	if knobVsPadPriority == sourceKnob && padSource[note] == sourceKnob {
+		debugLog("Pad %d held by knob, ignoring pad change", note)
+		return false
+	}
+	return true
+}
+
+// Global color temperature shift applied to lit pads when rendering
+// > 0 warms (adds red), < 0 cools (adds blue); guarded by stateMutex
+var colorTempShift int
+
+// Master brightness applied to every pad as the last render step (127 =
+// full), and the knob that sets it (0 = none); guarded by stateMutex
+var (
+	masterBrightness uint8 = 127
+	brightnessCC     uint8
+)
+
+// Apply grid-wide adjustments to the logical pad colors before sending
+func renderColors(colors [8]Color) [8]Color {
+	// A rejected config reload shows over everything, at full brightness
+	if reloadFlashing {
+		for i := range colors {
+			colors[i] = reloadFlashColor
+		}
+		return colors
+	}
+
+	// Lit split pads show one of their two colors in place of their own
+	for note, split := range splitPads {
+		if pos, ok := noteToPayloadPos[note]; ok && padState[note] {
+			colors[pos] = split[splitPhase]
+		}
+	}
+
+	// Momentary knobs show their preview over the pad's own color
+	for note, c := range knobPreview {
+		if pos, ok := noteToPayloadPos[note]; ok {
+			colors[pos] = c
+		}
+	}
+
+	// Pads under aftertouch pressure are brightened
+	for note, pressure := range padPressure {
+		if pos, ok := noteToPayloadPos[note]; ok {
+			colors[pos] = pressureColor(colors[pos], pressure)
+		}
+	}
+
+	// Blinking pads are dark for the off half of each blink
+	for note := range blinkPads {
+		if pos, ok := noteToPayloadPos[note]; ok && blinkPhaseOff[note] {
+			colors[pos] = colorOff
+		}
+	}
+
+	for i, c := range colors {
+		if c == colorOff {
+			continue
+		}
+		if colorTempShift > 0 {
+			c.R = byte(min(int(c.R)+colorTempShift, 127))
+		} else if colorTempShift < 0 {
+			c.B = byte(min(int(c.B)-colorTempShift, 127))
+		}
+
+		// Master dimmer last, so it scales everything above; lit channels
+		// stay at least 1 so a dimmed pad never looks off
+		colors[i] = lpd8.ScaleColor(c, masterBrightness)
+	}
+	return colors
+}
+
+// Build complete SysEx message for the selected device variant
+func buildSysEx(colors [8]Color) []byte {
+	return renderer.BuildSysEx(renderColors(colors))
+}
+
+// Decode the pad colors back out of a SysEx message built by buildSysEx
+// Returns false if the message isn't an LED update in the expected format
+func decodeSysEx(msg []byte) ([8]Color, bool) {
+	colors, err := lpd8.DecodeSysEx(msg)
+	if err != nil {
+		debugLog("SysEx ignored: %v", err)
+		return colors, false
+	}
+	return colors, true
+}
+
+// Amber to blues modes (see Config.AmberToBluesMode)
+const (
+	amberModeOpposite = "opposite"
+	amberModeSame     = "same"
+)
+
+// Knob modes (see Config.KnobMode)
+const (
+	knobModeBrightness = "brightness"
+	knobModeHue        = "hue"
+)
+
+// Whether a pad starts on: as set in initial_state, else top row on (blue)
+// and bottom row off; reserved pads (clock indicator, sequencer) are dark
+func initialPadOn(note uint8) bool {
+	if reservedPads[note] {
+		return false
+	}
+	if on, ok := initialState[note]; ok {
+		return on
+	}
+	return isTopRow[note]
+}
+
+// The color a pad shows when on: its knob-picked color, the active
+// palette's color, its configured pad color, the theme color of the channel
+// that last pressed it, else the row default
+func onColor(note uint8) Color {
+	if c, ok := pickedColors[note]; ok {
+		return c
+	}
+	if c, ok := paletteColor(note); ok {
+		return c
+	}
+	if c, ok := noteToColor[note]; ok {
+		return c
+	}
+	if c, ok := channelColor(note); ok {
+		return c
+	}
+	if isTopRow[note] {
+		return colorTopRow
+	}
+	return colorBottomRow
+}
+
+// Reload the config file on the live process, keeping the current on/off
+// state of pads that are still in the new config. Pads that disappear are
+// dropped and the whole grid is re-sent in a single SysEx.
+// If the file fails to load, the current mappings are kept.
+func reloadConfig(path string) {
+	if path == "" {
+		log.Println("Reload requested but no config file in use (running on defaults)")
+		return
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		log.Printf("Config reload failed, keeping current mappings: %v", err)
+		flashReloadError()
+		return
+	}
+
+	applyConfig(cfg)
+	log.Printf("Reloaded config from: %s", path)
+
+	if err := openProgramChangePorts(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// Switch the live mappings to cfg, keeping the on/off state of pads that are
+// still in it, and re-send the whole grid
+func applyConfig(cfg Config) {
+	mappingsMutex.Lock()
+	defer mappingsMutex.Unlock()
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	oldPos := noteToPayloadPos
+	oldReserved := reservedPads
+	buildMappings(cfg)
+
+	var colors [8]Color
+	for note, pos := range noteToPayloadPos {
+		on, known := padState[note]
+		if !known || (reservedPads[note] && !oldReserved[note]) {
+			on = initialPadOn(note)
+		}
+		padState[note] = on
+
+		// Keep the rendered color (e.g. knob brightness) if the pad didn't move
+		if p, ok := oldPos[note]; ok && p == pos && known && on {
+			colors[pos] = padColors[pos]
+		} else if on {
+			colors[pos] = onColor(note)
 		} else {
-			newColor = colorBottomRow // Amber
-			colorName = "AMBER"
+			colors[pos] = colorOff
 		}
+	}
+	for note := range padState {
+		if _, ok := noteToPayloadPos[note]; !ok {
+			debugLog("Pad %d no longer in config, turning off", note)
+			delete(padState, note)
+		}
+	}
+	padColors = colors
+	showSceneSlotsLocked()
+
+	queueSend()
+}
+
+// Toggle a pad's LED state and send update
+func togglePad(out Sender, note uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pos, ok := noteToPayloadPos[note]
+	if !ok {
+		return
+	}
+
+	// Toggle the state
+	padState[note] = !padState[note]
+	isOn := padState[note]
+
+	// Determine color based on state and row
+	var newColor Color
+	var colorName string
+	if isOn {
+		newColor = onColor(note)
+		colorName = fmt.Sprintf("ON %v", newColor)
 	} else {
 		newColor = colorOff
 		colorName = "OFF"
@@ -305,21 +1424,115 @@ func setPad(note uint8, on bool) {
 	padColors[pos] = newColor
 
 	// Send SysEx update
-	sysex := buildSysEx(padColors)
-	if err := sendSysEx(sysex); err != nil {
-		log.Printf("Error sending SysEx: %v", err)
+	sendPadsLocked(out)
+
+	debugLog("Pad %d toggled -> %s", note, colorName)
+}
+
+// Set a pad's LED state directly (not toggle)
+func setPad(out Sender, note uint8, on bool) {
+	setPadVelocity(out, note, on, 127)
+}
+
+// Set a pad's LED state directly, scaling its on-color by vel
+func setPadVelocity(out Sender, note uint8, on bool, vel uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pos, ok := noteToPayloadPos[note]
+	if !ok {
 		return
 	}
 
+	// Skip if already in desired state
+	if padState[note] == on {
+		return
+	}
+
+	padState[note] = on
+
+	// Determine color based on state and row
+	var newColor Color
+	var colorName string
+	if on {
+		newColor = lpd8.ScaleColor(onColor(note), vel)
+		colorName = fmt.Sprintf("ON %v", newColor)
+	} else {
+		newColor = colorOff
+		colorName = "OFF"
+	}
+
+	padColors[pos] = newColor
+	applyGroupLocked(note)
+
+	// Send SysEx update
+	sendPadsLocked(out)
+
 	debugLog("Pad %d set -> %s", note, colorName)
 }
 
-// Handle amber (bottom row) press - toggles amber AND sets controlled blues to opposite
+// If a pad is on, turn off the other pads in its exclusive group
+// Caller holds stateMutex and sends the update
+func applyGroupLocked(note uint8) {
+	if !padState[note] {
+		return
+	}
+	var off []uint8
+	for _, other := range padGroup[note] {
+		if !padState[other] || !padMayChange(other) {
+			continue
+		}
+		padState[other] = false
+		padColors[noteToPayloadPos[other]] = colorOff
+		off = append(off, other)
+	}
+	if len(off) > 0 {
+		debugLog("Pad %d ON, group pads %v OFF", note, off)
+	}
+}
+
+// Turn every pad off in a single SysEx
+func blackout() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if savePreBlackout && preBlackoutState == nil {
+		preBlackoutState = make(map[uint8]bool, len(noteToPayloadPos))
+		for note := range noteToPayloadPos {
+			preBlackoutState[note] = padState[note]
+		}
+	}
+	for note := range noteToPayloadPos {
+		padState[note] = false
+	}
+	padColors = [8]Color{}
+
+	queueSend()
+
+	debugLog("Blackout: all pads off")
+}
+
+// "ON" or "OFF", for logs
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// Handle amber (bottom row) press - toggles amber AND sets controlled blues to
+// opposite (or, in "same" mode, to the amber's own state)
 // All updates happen atomically in a single SysEx message
-func handleAmberPress(amberNote uint8) {
+// vel scales the amber's on-color (127 = full brightness)
+func handleAmberPress(out Sender, amberNote uint8, vel uint8) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 
+	handleAmberPressLocked(out, amberNote, vel)
+}
+
+// handleAmberPress with stateMutex already held
+func handleAmberPressLocked(out Sender, amberNote uint8, vel uint8) {
 	amberPos := noteToPayloadPos[amberNote]
 	blueNotes := amberToBlues[amberNote]
 
@@ -329,126 +1542,483 @@ func handleAmberPress(amberNote uint8) {
 
 	// Update amber color
 	if amberIsOn {
-		padColors[amberPos] = colorBottomRow // Amber ON
+		padColors[amberPos] = lpd8.ScaleColor(onColor(amberNote), vel) // Amber ON
 	} else {
 		padColors[amberPos] = colorOff // Amber OFF
 	}
 
-	// Set all controlled blues to OPPOSITE of amber
+	// Set all controlled blues to OPPOSITE of amber (or SAME as it)
+	bluesOn := !amberIsOn
+	if amberSameMode[amberNote] {
+		bluesOn = amberIsOn
+	}
 	var blueNames []uint8
 	for _, blueNote := range blueNotes {
+		if !padMayChange(blueNote) {
+			continue
+		}
 		bluePos := noteToPayloadPos[blueNote]
-		padState[blueNote] = !amberIsOn
-		if !amberIsOn {
-			padColors[bluePos] = colorTopRow // Blue ON
+		padSource[blueNote] = sourcePad
+		padState[blueNote] = bluesOn
+		if bluesOn {
+			padColors[bluePos] = onColor(blueNote) // Blue ON
 		} else {
 			padColors[bluePos] = colorOff // Blue OFF
 		}
 		blueNames = append(blueNames, blueNote)
 	}
 
-	if amberIsOn {
-		debugLog("Amber %d ON, Blues %v OFF", amberNote, blueNames)
-	} else {
-		debugLog("Amber %d OFF, Blues %v ON", amberNote, blueNames)
-	}
+	debugLog("Amber %d %s, Blues %v %s", amberNote, onOff(amberIsOn), blueNames, onOff(bluesOn))
+	applyGroupLocked(amberNote)
+	resetAutoOffLocked(amberNote)
 
 	// Send single SysEx with all updates
-	sysex := buildSysEx(padColors)
-	if err := sendSysEx(sysex); err != nil {
-		log.Printf("Error sending SysEx: %v", err)
-	}
+	sendPadsLocked(out)
 }
 
 // Handle blue (top row) press - toggles blue AND turns off any controlling ambers
-func handleBluePress(blueNote uint8) {
+// vel scales the blue's on-color (127 = full brightness)
+func handleBluePress(out Sender, blueNote uint8, vel uint8) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 
+	handleBluePressLocked(out, blueNote, vel)
+}
+
+// handleBluePress with stateMutex already held
+func handleBluePressLocked(out Sender, blueNote uint8, vel uint8) {
+	if !padMayChange(blueNote) {
+		return
+	}
+
 	bluePos := noteToPayloadPos[blueNote]
 
 	// Toggle blue
+	padSource[blueNote] = sourcePad
 	padState[blueNote] = !padState[blueNote]
 	blueIsOn := padState[blueNote]
 
 	// Update blue color
 	if blueIsOn {
-		padColors[bluePos] = colorTopRow // Blue ON
+		padColors[bluePos] = lpd8.ScaleColor(onColor(blueNote), vel) // Blue ON
 	} else {
 		padColors[bluePos] = colorOff // Blue OFF
 	}
 
-	// If blue is turning ON, turn off any ambers that were controlling it
+	// Turn off any ON ambers the blue no longer agrees with: an opposite
+	// amber when the blue turns ON, a same amber when it turns OFF
 	var ambersOff []uint8
-	if blueIsOn {
-		for _, amberNote := range blueToAmbers[blueNote] {
-			if padState[amberNote] { // Amber is currently ON
-				padState[amberNote] = false
-				amberPos := noteToPayloadPos[amberNote]
-				padColors[amberPos] = colorOff
-				ambersOff = append(ambersOff, amberNote)
+	for _, amberNote := range blueToAmbers[blueNote] {
+		if padState[amberNote] && blueIsOn != amberSameMode[amberNote] {
+			padState[amberNote] = false
+			amberPos := noteToPayloadPos[amberNote]
+			padColors[amberPos] = colorOff
+			ambersOff = append(ambersOff, amberNote)
+		}
+	}
+
+	if len(ambersOff) > 0 {
+		debugLog("Blue %d %s, Ambers %v OFF", blueNote, onOff(blueIsOn), ambersOff)
+	} else if blueIsOn {
+		debugLog("Blue %d ON", blueNote)
+	} else {
+		debugLog("Blue %d OFF", blueNote)
+	}
+	applyGroupLocked(blueNote)
+	resetAutoOffLocked(blueNote)
+
+	// Send single SysEx with all updates
+	sendPadsLocked(out)
+}
+
+// Handle knob (CC) change - controls blue LED based on value, with hysteresis
+// so a noisy knob doesn't flicker the LED:
+// while off, value >= knobOnThreshold turns the blue on
+// while on, value < knobOffThreshold turns it off
+// when on, brightness is scaled from the knob value
+// Knob range knob_in_min-max (0-64) maps to LED brightness knob_out_min-max (0-127)
+// With knob_smoothing, KnobToBlue values ease in through smoothKnob
+func handleKnobChange(out Sender, cc uint8, value uint8) {
+	metricKnobChanges.Add(1)
+	if handleSceneCC(cc, value) {
+		return
+	}
+	if brightnessCC != 0 && cc == brightnessCC {
+		handleBrightnessKnob(cc, value)
+		return
+	}
+	if sweep, ok := knobComet[cc]; ok {
+		handleCometKnob(cc, value, sweep)
+		return
+	}
+	if strength, ok := knobColorTemp[cc]; ok {
+		handleColorTempKnob(cc, value, strength)
+		return
+	}
+	if maxFade, ok := knobFadeTime[cc]; ok {
+		handleFadeKnob(cc, value, maxFade)
+		return
+	}
+	if target, ok := knobToChannel[cc]; ok {
+		handleColorChannelKnob(cc, value, target)
+		return
+	}
+
+	if _, ok := knobToBlue[cc]; !ok {
+		return
+	}
+	if knobSmoothing > 0 {
+		smoothKnob(out, cc, value, knobSmoothing)
+		return
+	}
+	applyBlueKnob(out, cc, value)
+}
+
+// Apply a KnobToBlue knob value to its blue (see handleKnobChange)
+func applyBlueKnob(out Sender, cc uint8, value uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	blueNote, ok := knobToBlue[cc]
+	if !ok {
+		return
+	}
+	pos, ok := noteToPayloadPos[blueNote]
+	if !ok {
+		return
+	}
+
+	if knobMomentary[cc] {
+		previewBlueKnobLocked(out, cc, blueNote, value)
+		return
+	}
+
+	// Knobs seen for the first time start from the pad's current state
+	wasOn, seen := knobOn[cc]
+	if !seen {
+		wasOn = padState[blueNote]
+	}
+	on := value >= knobOnThreshold || (wasOn && value >= knobOffThreshold)
+	knobOn[cc] = on
+
+	if !on {
+		// Turning the knob to 0 hands the pad back to whichever source moves next
+		held := padSource[blueNote] == sourcePad && knobVsPadPriority == sourcePad
+		padSource[blueNote] = ""
+		if held {
+			debugLog("Knob CC%d=%d -> Blue %d released by pad", cc, value, blueNote)
+			return
+		}
+
+		// Turn off
+		if !padState[blueNote] {
+			return // Already off
+		}
+		padState[blueNote] = false
+		padColors[pos] = colorOff
+		debugLog("Knob CC%d=%d -> Blue %d OFF", cc, value, blueNote)
+	} else {
+		if knobVsPadPriority == sourcePad && padSource[blueNote] == sourcePad {
+			debugLog("Knob CC%d=%d -> Blue %d held by pad, ignoring", cc, value, blueNote)
+			return
+		}
+		padSource[blueNote] = sourceKnob
+
+		padState[blueNote] = true
+		padColors[pos] = knobColor(cc, blueNote, value)
+		debugLog("Knob CC%d=%d -> Blue %d ON (color %v)", cc, value, blueNote, padColors[pos])
+	}
+
+	// Send SysEx update
+	sendPadsLocked(out)
+}
+
+// The color a lit KnobToBlue pad shows for a knob value
+// Caller must hold stateMutex
+func knobColor(cc uint8, note uint8, value uint8) Color {
+	if knobMode[cc] == knobModeHue {
+		// Full color wheel across the knob's range
+		return lpd8.HueColor(float64(value) / 128 * 360)
+	}
+	// On color with scaled brightness (gamma corrected)
+	return lpd8.ScaleColor(onColor(note), knobGammaTable[knobBrightness(value)])
+}
+
+// Apply a knob_momentary knob: show the knob's color over its pad while the
+// knob is up (same hysteresis as latching knobs), and the pad's own state as
+// soon as it's turned down. padState is never touched.
+// Caller must hold stateMutex
+func previewBlueKnobLocked(out Sender, cc uint8, note uint8, value uint8) {
+	on := value >= knobOnThreshold || (knobOn[cc] && value >= knobOffThreshold)
+	knobOn[cc] = on
+
+	if !on {
+		if _, shown := knobPreview[note]; !shown {
+			return
+		}
+		delete(knobPreview, note)
+		debugLog("Knob CC%d=%d -> Blue %d preview off", cc, value, note)
+	} else {
+		c := knobColor(cc, note, value)
+		if knobPreview[note] == c {
+			return
+		}
+		knobPreview[note] = c
+		debugLog("Knob CC%d=%d -> Blue %d preview (color %v)", cc, value, note, c)
+	}
+	sendPadsLocked(out)
+}
+
+// Cycle all pads through a fixed list of colors, waiting for Enter between each
+func runColorTest(out Sender) {
+	log.Println("Test mode: cycling LED colors...")
+	log.Println("Format: F0 47 7F 4C 06 00 30 [48 bytes] F7")
+
+	testColors := []struct {
+		name  string
+		color Color
+	}{
+		{"RED", Color{R: 127}},
+		{"GREEN", Color{G: 127}},
+		{"BLUE", Color{B: 127}},
+		{"WHITE", Color{R: 127, G: 127, B: 127}},
+		{"OFF", Color{}},
+	}
+
+	for _, tc := range testColors {
+		var colors [8]Color
+		for i := range colors {
+			colors[i] = tc.color
+		}
+
+		sysex := buildSysEx(colors)
+		fmt.Printf("\n%s - Sending %d bytes: % X\n", tc.name, len(sysex), sysex)
+
+		if err := out.Send(sysex); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Println("Sent!")
+		}
+
+		fmt.Print("Press Enter for next color...")
+		fmt.Scanln()
+	}
+
+	log.Println("Test complete")
+}
+
+// A single LED test from -test-pad/-test-color
+type padTest struct {
+	pos   int // Payload position (pad number - 1), -1 for every pad
+	color Color
+}
+
+// Parse -test-pad (1-8, 0 = every pad) and -test-color ("R,G,B", "" = white)
+func parsePadTest(pad int, color string) (padTest, error) {
+	if pad < 0 || pad > 8 {
+		return padTest{}, fmt.Errorf("-test-pad %d out of range 1-8", pad)
+	}
+	t := padTest{pos: pad - 1, color: Color{R: 127, G: 127, B: 127}}
+	if color != "" {
+		var r, g, b int
+		if n, err := fmt.Sscanf(color, "%d,%d,%d", &r, &g, &b); err != nil || n != 3 {
+			return padTest{}, fmt.Errorf("-test-color %q must be R,G,B, e.g. 0,127,0", color)
+		}
+		for _, v := range []int{r, g, b} {
+			if v < 0 || v > 127 {
+				return padTest{}, fmt.Errorf("-test-color %q: each channel must be 0-127", color)
+			}
+		}
+		t.color = Color{R: byte(r), G: byte(g), B: byte(b)}
+	}
+	return t, nil
+}
+
+// Send one SysEx lighting the test pad (or every pad) in the test color,
+// with the rest off
+func runPadTest(out Sender, t padTest) {
+	var colors [8]Color
+	for i := range colors {
+		if t.pos < 0 || i == t.pos {
+			colors[i] = t.color
+		}
+	}
+
+	sysex := buildSysEx(colors)
+	if t.pos < 0 {
+		log.Printf("Test: all pads %d,%d,%d", t.color.R, t.color.G, t.color.B)
+	} else {
+		log.Printf("Test: pad %d (payload position %d) %d,%d,%d, others off", t.pos+1, t.pos, t.color.R, t.color.G, t.color.B)
+	}
+	fmt.Printf("Sending %d bytes: % X\n", len(sysex), sysex)
+	if err := out.Send(sysex); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// Count of handler panics recovered by recoverHandler
+var recoveredPanics atomic.Uint64
+
+// Wrap a MIDI callback so a panic while processing one message is logged
+// with its stack trace instead of killing the bridge
+func recoverHandler(name string, h func(midi.Message, int32)) func(midi.Message, int32) {
+	return func(msg midi.Message, timestampms int32) {
+		defer func() {
+			if r := recover(); r != nil {
+				n := recoveredPanics.Add(1)
+				log.Printf("Recovered panic in %s handler (%d total) on %v: %v\n%s", name, n, msg, r, debug.Stack())
 			}
+		}()
+		h(msg, timestampms)
+	}
+}
+
+// Chase a light across the pads (pad 1 to 8) twice, each in its on color,
+// to show the bridge is talking to the device
+func runStartupSweep(out Sender) {
+	const step = 80 * time.Millisecond
+
+	var posColor [8]Color
+	for note, pos := range noteToPayloadPos {
+		posColor[pos] = onColor(note)
+	}
+
+	for pass := 0; pass < 2; pass++ {
+		for pos := range posColor {
+			var colors [8]Color
+			colors[pos] = posColor[pos]
+			if err := out.Send(buildSysEx(colors)); err != nil {
+				log.Printf("Startup sweep: %v", err)
+				return
+			}
+			time.Sleep(step)
 		}
 	}
+	if err := out.Send(buildSysEx([8]Color{})); err != nil {
+		log.Printf("Startup sweep: %v", err)
+	}
+}
 
-	if len(ambersOff) > 0 {
-		debugLog("Blue %d ON, Ambers %v OFF", blueNote, ambersOff)
-	} else if blueIsOn {
-		debugLog("Blue %d ON", blueNote)
-	} else {
-		debugLog("Blue %d OFF", blueNote)
-	}
+// Handle a color temperature knob - 64 is neutral, 0 is fully cool and 127
+// fully warm, shifting all lit pads by up to strength
+func handleColorTempKnob(cc uint8, value uint8, strength int) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
 
-	// Send single SysEx with all updates
-	sysex := buildSysEx(padColors)
-	if err := sendSysEx(sysex); err != nil {
-		log.Printf("Error sending SysEx: %v", err)
+	shift := (int(value) - 64) * strength / 64
+	if shift == colorTempShift {
+		return
 	}
+	colorTempShift = shift
+	debugLog("Color temp CC%d=%d -> shift %d", cc, value, shift)
+
+	queueSend()
 }
 
-// Handle knob (CC) change - controls blue LED based on value
-// value < 2: blue turns off
-// value >= 2: blue turns on with brightness scaled from knob value
-// Knob range 0-64 maps to LED brightness 0-127
-func handleKnobChange(cc uint8, value uint8) {
-	blueNote, ok := knobToBlue[cc]
-	if !ok {
+// Handle the master brightness knob - the knob value is the brightness
+func handleBrightnessKnob(cc uint8, value uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	brightness := knobGammaTable[value]
+	if brightness == masterBrightness {
 		return
 	}
+	masterBrightness = brightness
+	debugLog("Brightness CC%d=%d -> %d", cc, value, brightness)
+
+	queueSend()
+}
 
+// Handle a color picker knob - set one channel of the pad's on color to the
+// knob value; a lit pad shows it straight away, an unlit one when next on
+func handleColorChannelKnob(cc uint8, value uint8, target KnobColorChannel) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 
-	pos, ok := noteToPayloadPos[blueNote]
+	note := uint8(target.Note)
+	pos, ok := noteToPayloadPos[note]
 	if !ok {
 		return
 	}
 
-	if value < 2 {
-		// Turn off
-		if !padState[blueNote] {
-			return // Already off
+	c := onColor(note)
+	switch target.Channel {
+	case "r":
+		c.R = value
+	case "g":
+		c.G = value
+	case "b":
+		c.B = value
+	}
+	pickedColors[note] = c
+	debugLog("Color CC%d=%d -> pad %d %v", cc, value, note, c)
+
+	if padState[note] {
+		padColors[pos] = c
+		queueSend()
+	}
+}
+
+// Handle a comet knob - position the head along the row from the knob value
+// and fade the Tail pads behind it, all in one SysEx
+// value < 2 turns the whole row off
+func handleCometKnob(cc uint8, value uint8, sweep cometSweep) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	head := -1
+	if value >= 2 {
+		head = int(value) * len(sweep.notes) / 128
+	}
+
+	for i, note := range sweep.notes {
+		pos, ok := noteToPayloadPos[note]
+		if !ok {
+			continue
 		}
-		padState[blueNote] = false
-		padColors[pos] = colorOff
-		debugLog("Knob CC%d=%d -> Blue %d OFF", cc, value, blueNote)
-	} else {
-		// Turn on with scaled brightness (0-64 -> 0-127)
-		brightness := value * 2
-		if brightness > 127 {
-			brightness = 127
+
+		// Brightness falls off linearly with distance behind the head
+		dist := head - i
+		if head < 0 || dist < 0 || dist > sweep.tail {
+			padState[note] = false
+			padColors[pos] = colorOff
+			continue
+		}
+		scale := float64(sweep.tail+1-dist) / float64(sweep.tail+1)
+		padState[note] = true
+		padColors[pos] = Color{
+			R: byte(float64(sweep.color.R) * scale),
+			G: byte(float64(sweep.color.G) * scale),
+			B: byte(float64(sweep.color.B) * scale),
 		}
-		padState[blueNote] = true
-		padColors[pos] = Color{0, 0, brightness} // Blue with variable brightness
-		debugLog("Knob CC%d=%d -> Blue %d ON (brightness %d)", cc, value, blueNote, brightness)
 	}
+	debugLog("Comet CC%d=%d -> head %d", cc, value, head)
 
-	// Send SysEx update
-	sysex := buildSysEx(padColors)
-	if err := sendSysEx(sysex); err != nil {
-		log.Printf("Error sending SysEx: %v", err)
-		return
+	queueSend()
+}
+
+// Open the LED tap output: an existing port with that name, or else a new
+// virtual port (virtual ports aren't supported by every platform's driver)
+func openLEDTap(name string) (drivers.Out, error) {
+	out, err := findOutPort(name)
+	if err == nil {
+		if err := out.Open(); err != nil {
+			return nil, err
+		}
+		return out, nil
 	}
+	if !errors.Is(err, errNoPort) {
+		return nil, err
+	}
+
+	drv, ok := drivers.Get().(interface {
+		OpenVirtualOut(name string) (drivers.Out, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("MIDI driver doesn't support virtual ports")
+	}
+	return drv.OpenVirtualOut(name)
 }
 
 func listPorts() {
@@ -464,28 +2034,168 @@ func listPorts() {
 
 func main() {
 	var (
-		listOnly   bool
-		outputPort string
-		spyPort    string
-		configPath string
-		genConfig  string
-		testMode   bool
+		listOnly    bool
+		outputPorts portList
+		spyPorts    portList
+		configPath  string
+		configDir   string
+		genConfig   string
+		testMode    bool
+		serialPort  string
+		serialBaud  int
+		schemaOnly  bool
+		ledTap      string
+		reconnect   bool
+		testPort    string
+		testPad     int
+		testColor   string
+		httpAddr    string
+		metricsAddr string
+		trayMode    bool
+		tuiMode     bool
+		offOnExit   bool
+		stateFile   string
+		oscAddr     string
+		oscOut      string
+		sweep       bool
+		logFormat   string
+		refresh     time.Duration
+		variant     string
+		feedback    string
+		feedbackCh  int
+		lintPath    string
+		recordPath  string
+		thruPort    string
+		replayPath  string
+		identify    bool
+		watchIns    bool
 	)
 
+	flag.StringVar(&variant, "variant", variantMK2, "LPD8 model whose LED protocol to speak (only mk2 has settable pad LEDs)")
 	flag.BoolVar(&listOnly, "list", false, "List available MIDI ports and exit")
-	flag.StringVar(&outputPort, "out", "", "MIDI output port name (sends to LPD8)")
-	flag.StringVar(&spyPort, "spy", "", "MIDI input to mirror button presses from (e.g., PLX-CRSS12)")
-	flag.StringVar(&configPath, "config", "", "Path to config file (JSON)")
+	flag.Var(&outputPorts, "out", "MIDI output port name (sends to LPD8); repeat or comma-separate to mirror to several")
+	flag.Var(&spyPorts, "spy", "MIDI input to mirror button presses from (e.g., PLX-CRSS12); repeat or comma-separate for several")
+	flag.StringVar(&configPath, "config", "", "Path to config file (JSON, or YAML with a .yaml/.yml extension)")
+	flag.StringVar(&configDir, "config-dir", "", "Directory of config profiles, switched by incoming Program Change (program N = Nth file by name)")
+	flag.StringVar(&lintPath, "lint", "", "Check a config file for errors and dead or conflicting mappings, then exit")
 	flag.StringVar(&genConfig, "genconfig", "", "Generate default config file at path and exit")
+	flag.BoolVar(&sweep, "startup-sweep", false, "Chase a light across all pads at startup to confirm the LPD8 is responding")
 	flag.BoolVar(&testMode, "test", false, "Test LED colors and exit")
+	flag.StringVar(&testPort, "test-port", "", "Test LED colors on this MIDI output port and exit (no config needed)")
+	flag.IntVar(&testPad, "test-pad", 0, "Light only this pad (1-8, as numbered on the LPD8) and exit, to check pad positions")
+	flag.StringVar(&testColor, "test-color", "", "Color for -test-pad as R,G,B (0-127 each, default white); alone, lights every pad")
+	flag.BoolVar(&schemaOnly, "schema", false, "Print a JSON Schema for the config file and exit")
 	flag.BoolVar(&debugMode, "debug", false, "Enable debug logging")
+	flag.StringVar(&logFormat, "log-format", logFormatText, "Log output format: text, or json for one JSON object per line")
+	flag.BoolVar(&dryRun, "dry-run", false, "Don't open output ports; print each LED SysEx to stdout instead")
+	flag.StringVar(&httpAddr, "http", "", "Serve the HTTP API on this address (e.g., :8080)")
+	flag.StringVar(&metricsAddr, "metrics", "", "Serve Prometheus metrics at /metrics on this address (e.g., :9100)")
+	flag.StringVar(&feedback, "feedback", "", "MIDI output to send pad state changes to as Note On/Off")
+	flag.IntVar(&feedbackCh, "feedback-channel", 1, "MIDI channel for -feedback (1-16)")
+	flag.BoolVar(&identify, "identify", false, "Send a MIDI identity request at startup and log the replies")
+	flag.StringVar(&thruPort, "thru", "", "Forward every message from the listened inputs unchanged to this MIDI output")
+	flag.StringVar(&oscAddr, "osc", "", "Listen for OSC pad messages on this UDP address (e.g., :9000)")
+	flag.StringVar(&oscOut, "osc-out", "", "Send OSC pad state changes to this host:port (default: the last OSC client)")
+	flag.BoolVar(&clockSync, "clock-sync", false, "Blink pads on the beat of incoming MIDI clock (falls back to blink_ms without clock)")
+	flag.DurationVar(&debounceWindow, "debounce", debounceWindow, "Ignore a second press of the same pad from the same device within this window (0 = off)")
+	flag.DurationVar(&refresh, "refresh", 0, "Re-send the full LED state this often, e.g. 2s, in case the LPD8 drops an update (0 = off)")
+	flag.StringVar(&recordPath, "record", "", "Record every incoming MIDI message with its timing to this file")
+	flag.StringVar(&replayPath, "replay", "", "Feed a -record file through the input handlers instead of listening to MIDI inputs")
+	flag.BoolVar(&watchIns, "watch-inputs", false, "Poll for MIDI inputs plugged in (or back in) after startup and listen to them")
+	flag.BoolVar(&reconnect, "reconnect", true, "Reconnect to the output port if the LPD8 is unplugged")
+	flag.StringVar(&serialPort, "serial", "", "Serial port to stream LED state lines to (e.g., /dev/ttyUSB0)")
+	flag.IntVar(&serialBaud, "serial-baud", 115200, "Baud rate for -serial")
+	flag.StringVar(&stateFile, "state", "", "Save pad on/off state to this file as it changes and on exit, and restore it at startup")
+	flag.BoolVar(&offOnExit, "off-on-exit", true, "Turn all pad LEDs off on exit (-off-on-exit=false leaves them as they are)")
+	flag.BoolVar(&tuiMode, "tui", false, "Show live pad states in the terminal (q or Ctrl+C to quit)")
+	flag.BoolVar(&trayMode, "tray", false, "Show a system tray icon with pad status and blackout/reload/quit")
+	flag.StringVar(&ledTap, "led-tap", "", "Mirror LED SysEx to this MIDI output (created as a virtual port if it doesn't exist)")
 	flag.Parse()
 
+	if err := setupLogging(logFormat); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyEnvDefaults(); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	if renderer, err = rendererFor(variant); err != nil {
+		log.Fatal(err)
+	}
+
+	// Lint a config file (no MIDI needed)
+	if lintPath != "" {
+		os.Exit(runLint(lintPath))
+	}
+
 	defer midi.CloseDriver()
 
+	if trayMode && !traySupported {
+		log.Fatal("-tray needs a build with tray support (go build -tags tray)")
+	}
+	if tuiMode {
+		if trayMode || logFormat == logFormatJSON {
+			log.Fatal("-tui can't be combined with -tray or -log-format json")
+		}
+		if err := checkTUI(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if recordPath != "" && replayPath != "" {
+		log.Fatal("-record can't be combined with -replay")
+	}
+	if replayPath != "" && len(spyPorts) > 0 {
+		log.Fatal("-replay can't be combined with -spy: the recording replaces the devices")
+	}
+
+	// Print config schema if requested
+	if schemaOnly {
+		schema, err := configSchema()
+		if err != nil {
+			log.Fatalf("Failed to generate schema: %v", err)
+		}
+		os.Stdout.Write(schema)
+		return
+	}
+
+	// A single pad/color test replaces the color cycle
+	var singleTest *padTest
+	if testPad != 0 || testColor != "" {
+		t, err := parsePadTest(testPad, testColor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		singleTest = &t
+	}
+
+	// Quick color test on any port, without config or the rest of the setup
+	if testPort != "" {
+		out, err := findOutPort(testPort)
+		if err != nil {
+			log.Fatalf("Output port not found: %s (%v)", testPort, err)
+		}
+		send, err := midi.SendTo(out)
+		if err != nil {
+			log.Fatalf("Failed to open output port: %v", err)
+		}
+		testOut := SenderFunc(func(data []byte) error {
+			return send(data)
+		})
+		if singleTest != nil {
+			runPadTest(testOut, *singleTest)
+		} else {
+			runColorTest(testOut)
+		}
+		return
+	}
+
 	// Generate config file if requested
 	if genConfig != "" {
 		cfg := defaultConfig()
+		if err := validateConfig(cfg); err != nil {
+			log.Fatalf("Default config is invalid: %v", err)
+		}
 		if err := saveConfig(genConfig, cfg); err != nil {
 			log.Fatalf("Failed to write config: %v", err)
 		}
@@ -493,7 +2203,22 @@ func main() {
 		return
 	}
 
-	// Load config (or use defaults)
+	// Load config (the first -config-dir profile, else explicit -config, else
+	// the first file on the search path, else defaults)
+	if configDir != "" {
+		if configPath != "" {
+			log.Fatal("Use either -config or -config-dir, not both")
+		}
+		var err error
+		if profiles, err = loadProfiles(configDir); err != nil {
+			log.Fatalf("Failed to load profiles: %v", err)
+		}
+		configPath = profiles[0].path
+		log.Printf("Loaded %d profiles from %s: %s", len(profiles), configDir, profileNames())
+	}
+	if configPath == "" {
+		configPath = findConfig()
+	}
 	var cfg Config
 	if configPath != "" {
 		var err error
@@ -512,203 +2237,718 @@ func main() {
 		return
 	}
 
-	if outputPort == "" {
+	if len(outputPorts) == 0 && !dryRun {
 		fmt.Println("Usage: lpd8-led-bridge -out \"LPD8 Port Name\" [options]")
 		fmt.Println()
 		fmt.Println("Options:")
-		fmt.Println("  -spy \"PORT\"      Mirror button presses from another device")
-		fmt.Println("  -config FILE     Load config from JSON file")
+		fmt.Println("  -spy \"PORT\"      Mirror button presses from another device (repeatable)")
+		fmt.Println("  -config FILE     Load config from JSON or YAML file")
+		fmt.Println("  -config-dir DIR  Config profiles switched by Program Change")
 		fmt.Println("  -genconfig FILE  Generate default config file and exit")
+		fmt.Println("  -schema          Print config JSON Schema and exit")
+		fmt.Println("  -http ADDR       Serve the HTTP API (e.g., :8080)")
+		fmt.Println("  -osc ADDR        Listen for OSC pad messages (e.g., :9000)")
 		fmt.Println("  -list            List available MIDI ports")
 		fmt.Println("  -test            Test LED colors")
+		fmt.Println("  -test-port PORT  Test LED colors on any port and exit")
+		fmt.Println("  -test-pad N      Light only pad N (1-8) and exit")
+		fmt.Println("  -test-color R,G,B  Color for -test-pad (default white)")
+		fmt.Println("  -serial PORT     Stream LED state to a serial port")
+		fmt.Println("  -led-tap PORT    Mirror LED SysEx to another (or virtual) MIDI port")
+		fmt.Println("  -dry-run         Print LED SysEx instead of sending it (no LPD8 needed)")
+		fmt.Println("  -state FILE      Save pad state on exit and restore it at startup")
+		fmt.Println("  -record FILE     Record incoming MIDI to a file")
+		fmt.Println("  -replay FILE     Replay a -record file instead of listening to inputs")
+		fmt.Println("  -tray            Show a system tray status icon (tray builds only)")
+		fmt.Println()
+		printEnvUsage()
 		fmt.Println()
 		listPorts()
 		os.Exit(1)
 	}
 
-	// Find output port
-	outPort, err := midi.FindOutPort(outputPort)
-	if err != nil {
-		log.Fatalf("Output port not found: %s (%v)", outputPort, err)
+	// Read a replay up front so a bad file fails before anything is sent
+	var replay []recordedMsg
+	if replayPath != "" {
+		var err error
+		if replay, err = readRecording(replayPath); err != nil {
+			log.Fatalf("Failed to read replay: %v", err)
+		}
+	}
+	var recorder *midiRecorder
+	if recordPath != "" {
+		var err error
+		if recorder, err = openMIDIRecorder(recordPath); err != nil {
+			log.Fatalf("Failed to open recording: %v", err)
+		}
+		defer recorder.Close()
+		log.Printf("Recording MIDI input to %s", recordPath)
 	}
 
-	// Create send function using the output port
-	send, err := midi.SendTo(outPort)
-	if err != nil {
-		log.Fatalf("Failed to open output port: %v", err)
+	// Cancelled on SIGINT/SIGTERM (or Quit in the tray/TUI); every background
+	// worker stops on it, then shutdown waits for each in a fixed order
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Open every output port; each reconnects on its own if its LPD8 goes away
+	var outputs ledOutputs
+	for _, name := range outputPorts {
+		if dryRun {
+			break
+		}
+		outPort, err := findOutPort(name)
+		if err != nil {
+			log.Fatalf("Output port not found: %s (%v)", name, err)
+		}
+		send, err := midi.SendTo(outPort)
+		if err != nil {
+			log.Fatalf("Failed to open output port %s: %v", name, err)
+		}
+		outputs = append(outputs, newLEDOutput(ctx, portLookupName(name, outPort), outPort, send, reconnect))
 	}
 
-	// Set the global send function for SysEx
-	sendSysEx = func(data []byte) error {
-		return send(data)
+	// LED SysEx goes to every output (or stdout for a dry run)
+	var sender Sender = outputs
+	if dryRun {
+		log.Println("Dry run: not opening output ports, LED SysEx is printed to stdout")
+		sender = SenderFunc(func(data []byte) error {
+			fmt.Printf("SysEx %d bytes: % X\n", len(data), data)
+			return nil
+		})
 	}
 
-	// Test mode - cycle through colors
-	if testMode {
-		log.Println("Test mode: cycling LED colors...")
-		log.Println("Format: F0 47 7F 4C 06 00 30 [48 bytes] F7")
+	if err := openProgramChangePorts(); err != nil {
+		log.Fatalf("Failed to open Program Change output: %v", err)
+	}
 
-		testColors := []struct {
-			name  string
-			color Color
-		}{
-			{"RED", Color{127, 0, 0}},
-			{"GREEN", Color{0, 127, 0}},
-			{"BLUE", Color{0, 0, 127}},
-			{"WHITE", Color{127, 127, 127}},
-			{"OFF", Color{0, 0, 0}},
-		}
+	// Mirror every LED update to the serial port as a state line
+	if serialPort != "" {
+		serialOut := newSerialOutput(serialPort, serialBaud)
+		defer serialOut.Close()
 
-		for _, tc := range testColors {
-			var colors [8]Color
-			for i := range colors {
-				colors[i] = tc.color
+		next := sender
+		sender = SenderFunc(func(data []byte) error {
+			if colors, ok := decodeSysEx(data); ok {
+				serialOut.writeState(colors)
 			}
+			return next.Send(data)
+		})
+	}
 
-			sysex := buildSysEx(colors)
-			fmt.Printf("\n%s - Sending %d bytes: % X\n", tc.name, len(sysex), sysex)
+	// OSC control surface; every frame sent also syncs changed pad states back
+	if oscAddr != "" {
+		oscSrv, err := startOSCServer(oscAddr, oscOut)
+		if err != nil {
+			log.Fatalf("Failed to start OSC: %v", err)
+		}
+		defer oscSrv.Close()
 
-			if err := sendSysEx(sysex); err != nil {
-				fmt.Printf("Error: %v\n", err)
-			} else {
-				fmt.Println("Sent!")
-			}
+		next := sender
+		sender = SenderFunc(func(data []byte) error {
+			oscSrv.sendState()
+			return next.Send(data)
+		})
+	}
+
+	// Pad state feedback over MIDI; every frame sent also sends changed pads
+	var feedbackPort string
+	if feedback != "" {
+		if feedbackCh < 1 || feedbackCh > 16 {
+			log.Fatalf("-feedback-channel %d out of range 1-16", feedbackCh)
+		}
+		fb, err := startFeedback(feedback, feedbackCh)
+		if err != nil {
+			log.Fatalf("Failed to open feedback port: %v", err)
+		}
+		feedbackPort = fb.name
+		log.Printf("Pad state feedback: %s (channel %d)", feedback, feedbackCh)
+
+		next := sender
+		sender = SenderFunc(func(data []byte) error {
+			fb.sendState()
+			return next.Send(data)
+		})
+	}
+
+	// Forward everything the inputs receive to a thru port
+	var thru *midiThru
+	if thruPort != "" {
+		var err error
+		if thru, err = openThru(thruPort); err != nil {
+			log.Fatalf("Failed to open thru port: %v", err)
+		}
+		log.Printf("MIDI thru: %s", thruPort)
+	}
+
+	// Mirror every LED SysEx to a tap port for recording in MIDI tools
+	if ledTap != "" {
+		tap, err := openLEDTap(ledTap)
+		if err != nil {
+			log.Printf("Warning: couldn't open LED tap %s: %v", ledTap, err)
+		} else {
+			defer tap.Close()
+			log.Printf("LED tap: %s", ledTap)
 
-			fmt.Print("Press Enter for next color...")
-			fmt.Scanln()
+			next := sender
+			sender = SenderFunc(func(data []byte) error {
+				if err := tap.Send(data); err != nil {
+					debugLog("LED tap send failed: %v", err)
+				}
+				return next.Send(data)
+			})
 		}
+	}
 
-		log.Println("Test complete")
+	// Test mode - light one pad/color, or cycle through colors
+	if singleTest != nil {
+		runPadTest(sender, *singleTest)
+		return
+	}
+	if testMode {
+		cancel() // Let Ctrl+C end the test while it waits on Enter
+		runColorTest(sender)
 		return
 	}
 
-	// Initialize pad states and LED colors from config
+	// Visual self-test before the initial state (inputs aren't attached yet,
+	// so no presses are lost to the animation)
+	if sweep {
+		runStartupSweep(sender)
+	}
+
+	// Initialize pad states and LED colors from the saved state if there is
+	// one, else from config (initial_state)
 	// Top row: ON by default (Blue)
 	// Bottom row: OFF by default (Black)
-	for _, note := range cfg.LPD8.TopRow {
-		n := uint8(note)
-		padState[n] = true // Top row starts ON
-		pos := noteToPayloadPos[n]
-		padColors[pos] = colorTopRow // Blue
+	var restored map[uint8]bool
+	if stateFile != "" {
+		var polarity map[uint8]bool
+		restored, polarity = loadState(stateFile)
+		restoreAmberPolarity(polarity)
 	}
-	for _, note := range cfg.LPD8.BottomRow {
-		n := uint8(note)
-		padState[n] = false // Bottom row starts OFF
-		pos := noteToPayloadPos[n]
-		padColors[pos] = colorOff // Off
+	for note, pos := range noteToPayloadPos {
+		padState[note] = initialPadOn(note)
+		if on, ok := restored[note]; ok && !reservedPads[note] {
+			padState[note] = on
+		}
+		if padState[note] {
+			padColors[pos] = onColor(note)
+		} else {
+			padColors[pos] = colorOff
+		}
+	}
+
+	// All LED updates from here on go through the frame sender
+	stopFrames := startFrameSender(ctx, sender)
+	queueSend()
+	stopSaver := func() {}
+	if stateFile != "" {
+		stopSaver = startStateSaver(ctx, stateFile)
+	}
+	if restored != nil {
+		log.Printf("Initial LED state restored from: %s", stateFile)
+	} else if len(initialState) > 0 {
+		log.Printf("Initial LED state set from initial_state (%d pads), others Top=Blue(ON), Bottom=OFF", len(initialState))
+	} else {
+		log.Println("Initial LED state set: Top=Blue(ON), Bottom=OFF")
+	}
+
+	stopBlink := startBlinker(ctx)
+	stopTempo := startTapTempo(ctx)
+	stopRefresh := func() {}
+	if refresh > 0 {
+		stopRefresh = startRefresher(ctx, refresh)
+		log.Printf("Refreshing LED state every %v", refresh)
 	}
 
-	sysex := buildSysEx(padColors)
-	sendSysEx(sysex)
-	log.Println("Initial LED state set: Top=Blue(ON), Bottom=OFF")
+	// Apply an accepted press of a normal pad
+	applyPadPress := func(source string, note uint8, vel uint8) {
+		seq.record(source, note, vel)
+		if source != sequencerSource {
+			pushUndo()
+		}
+
+		// Full brightness unless this source's velocity is in use
+		if !velocitySensitive && (!isSpySource(source) || !spyVelocityBrightness) {
+			vel = 127
+		}
+
+		if momentaryPads[note] {
+			// Momentary pads light while held and go dark on release
+			setPadVelocity(ledOut, note, true, vel)
+		} else if _, isAmber := amberToBlues[note]; isAmber {
+			// Bottom row (amber) - toggle amber AND set controlled blues to opposite
+			handleAmberPress(ledOut, note, vel)
+		} else if _, isCycle := amberColorCycle[note]; isCycle {
+			// Bottom row (amber) - step the blue above through its colors
+			handleAmberCyclePress(note, vel)
+		} else {
+			// Top row (blue) - toggle and turn off controlling ambers
+			handleBluePress(ledOut, note, vel)
+		}
+		pressKeys(note)
+		sendProgramChange(note)
+	}
 
 	// Shared button press handler - processes a pad note press
-	processPadPress := func(source string, note uint8) {
+	// vel is the press velocity, used to scale brightness where enabled;
+	// ts is the MIDI timestamp in ms (0 = none), used for debouncing
+	processPadPress := func(source string, note uint8, vel uint8, ts int32) {
+		// Sequencer record/play pads
+		if source != sequencerSource && seq.isControl(note) {
+			if notePressed(source, note) {
+				seq.handlePress(note)
+			}
+			return
+		}
+
+		// Tap tempo pad
+		if isTapTempoNote(note) {
+			if notePressed(source, note) {
+				handleTap()
+			}
+			return
+		}
+
+		// Palette cycle pad
+		if isPaletteCycleNote(note) {
+			if notePressed(source, note) {
+				cyclePalette()
+			}
+			return
+		}
+
+		// Polarity modifier pad, and ambers pressed while it's held
+		if isPolarityToggleNote(note) {
+			if notePressed(source, note) {
+				setPolarityHeld(true)
+			}
+			return
+		}
+		if source != sequencerSource && polarityFlipPress(note) {
+			if notePressed(source, note) {
+				flipAmberPolarity(note)
+			}
+			return
+		}
+
+		// Scene store/recall pads
+		if isSceneControl(note) {
+			if notePressed(source, note) {
+				handleScenePress(note)
+			}
+			return
+		}
+
 		// Check if this is a valid pad note
-		if _, ok := noteToPayloadPos[note]; ok {
-			debugLog("%s pad press: note=%d", source, note)
+		if _, ok := noteToPayloadPos[note]; ok && !reservedPads[note] {
+			// Replayed presses skip loop/repeat/merge filtering - they were filtered when recorded
+			if source != sequencerSource && (!loopCheck(note) || !debounced(source, note, ts) || !notePressed(source, note) || !acceptPress(source, note) || !padCooledDown(note)) {
+				return
+			}
+			debugLog("%s pad press: note=%d vel=%d", source, note, vel)
+			metricPadPresses.Add(1)
+			aftertouchPress(source, note)
 
-			// Bottom row (amber) - toggle amber AND set controlled blues to opposite
-			if _, isAmber := amberToBlues[note]; isAmber {
-				handleAmberPress(note)
-			} else {
-				// Top row (blue) - toggle and turn off controlling ambers
-				handleBluePress(note)
+			// Long-press pads wait for the release (a tap) or the hold
+			if source != sequencerSource && startLongPress(source, note, vel) {
+				return
+			}
+
+			// Double-tap pads wait for a second press or the window to pass
+			if source != sequencerSource && startDoubleTap(source, note, ts, func() { applyPadPress(source, note, vel) }) {
+				return
 			}
+			applyPadPress(source, note, vel)
+		}
+	}
+
+	seq.press = func(source string, note uint8, vel uint8) {
+		processPadPress(source, note, vel, 0)
+	}
+
+	// Shared release handler - processes a Note Off (or Note On with velocity 0)
+	// vel is the Note Off (release) velocity, 0 if there is none
+	processPadRelease := func(source string, note uint8, vel uint8) {
+		noteReleased(source, note)
+		seq.handleRelease(note)
+		if isPolarityToggleNote(note) {
+			setPolarityHeld(false)
+		}
+		aftertouchRelease(source, note)
+
+		if vel, tap := endLongPress(source, note); tap {
+			debugLog("%s pad tap: note=%d", source, note)
+			applyPadPress(source, note, vel)
+			return
+		}
+
+		if momentaryPads[note] && !reservedPads[note] {
+			debugLog("%s pad release: note=%d vel=%d", source, note, vel)
+			releaseMomentaryPad(note, vel)
 		}
 	}
 
 	// MIDI message handler for LPD8
 	handler := func(msg midi.Message, timestampms int32) {
+		mappingsMutex.RLock()
+		defer mappingsMutex.RUnlock()
+
 		var ch, key, val uint8
 
 		switch {
+		case msg.GetNoteOn(&ch, &key, &val) && isPanicNote(key, val):
+			panicReset("LPD8")
+		case msg.GetControlChange(&ch, &key, &val) && isPanicCC(key, val):
+			panicReset("LPD8")
+		case msg.GetNoteOn(&ch, &key, &val) && isUndoNote(key, val):
+			undo("LPD8")
+		case msg.GetControlChange(&ch, &key, &val) && isUndoCC(key, val):
+			undo("LPD8")
 		case msg.GetNoteOn(&ch, &key, &val):
-			// Only respond to configured channel and actual pad presses (vel > 0)
-			if ch == lpd8Channel && val > 0 {
-				processPadPress("LPD8", key)
+			// Only respond to configured channel (or all, 255) and actual pad
+			// presses (vel > 0)
+			if isPadChannel(ch) && val > 0 {
+				notePadChannel(key, ch)
+				processPadPress("LPD8", key, val, timestampms)
+			} else if isPadChannel(ch) {
+				processPadRelease("LPD8", key, 0)
+			}
+		case msg.GetNoteOff(&ch, &key, &val):
+			if isPadChannel(ch) {
+				processPadRelease("LPD8", key, val)
 			}
 		case msg.GetControlChange(&ch, &key, &val):
+			// Host feedback CCs drive their pad directly, they aren't knobs
+			if note, ok := ccFeedback[key]; ok && (ccFeedbackChannel == 255 || ch == ccFeedbackChannel) {
+				debugLog("Feedback CC%d=%d ch=%d -> pad %d", key, val, ch, note)
+				setPad(ledOut, note, val >= ccFeedbackThreshold)
+				return
+			}
 			// Handle knob (CC) changes - accept configured channel or all (255)
 			if lpd8KnobChannel == 255 || ch == lpd8KnobChannel {
-				handleKnobChange(key, val)
+				// Knobs used as buttons press their pad above the threshold
+				// and release it below, so every pad feature and filter
+				// applies
+				if note, ok := knobToToggle[key]; ok {
+					release, press := knobToggleStep(key, val)
+					if release {
+						debugLog("Knob toggle CC%d=%d -> pad %d released", key, val, note)
+						processPadRelease(knobToggleSource, note, 0)
+					}
+					if press {
+						debugLog("Knob toggle CC%d=%d -> pad %d pressed", key, val, note)
+						processPadPress(knobToggleSource, note, 127, timestampms)
+					}
+					return
+				}
+				handleKnobChange(ledOut, key, val)
+			}
+		case msg.GetPolyAfterTouch(&ch, &key, &val):
+			if isPadChannel(ch) {
+				handlePadPressure(key, val)
 			}
+		case msg.GetAfterTouch(&ch, &val):
+			if isPadChannel(ch) {
+				handleChannelPressure("LPD8", val)
+			}
+		case msg.GetProgramChange(&ch, &val):
+			// Program number selects the -config-dir profile
+			if len(profiles) > 0 {
+				queueProfileSwitch(int(val))
+			}
+		case msg.Is(midi.TimingClockMsg):
+			handleClockTick()
+		case msg.Is(midi.SysExMsg):
+			handleSysExInput(msg)
 		}
 	}
 
-	var stopFuncs []func()
-
-	// Set up spy port listener if specified (PLX-CRSS12 button presses)
-	if spyPort != "" {
-		spyIn, err := midi.FindInPort(spyPort)
-		if err != nil {
-			log.Fatalf("Spy port not found: %s (%v)", spyPort, err)
-		}
+	// Spy handler - mirror button presses from a spy device (e.g. PLX-CRSS12),
+	// remapping notes with the table for port (or arg, its -spy name)
+	// Accept any channel since we don't know what channel the spy uses
+	newSpyHandler := func(arg, port string) func(midi.Message, int32) {
+		source := spySource(port)
+		return func(msg midi.Message, timestampms int32) {
+			mappingsMutex.RLock()
+			defer mappingsMutex.RUnlock()
 
-		// Spy handler - mirror button presses from PLX-CRSS12
-		// Accept any channel since we don't know what channel the CRSS12 uses
-		spyHandler := func(msg midi.Message, timestampms int32) {
-			var ch, note, vel uint8
+			var ch, note, vel, cc, value uint8
+			metricSpyEvents.Add(1)
+			remap := spyRemapFor(arg, port)
 
 			switch {
+			case msg.GetNoteOn(&ch, &note, &vel) && isPanicNote(note, vel):
+				panicReset(source)
+			case msg.GetControlChange(&ch, &cc, &value) && isPanicCC(cc, value):
+				panicReset(source)
+			case msg.GetNoteOn(&ch, &note, &vel) && isUndoNote(note, vel):
+				undo(source)
+			case msg.GetControlChange(&ch, &cc, &value) && isUndoCC(cc, value):
+				undo(source)
 			case msg.GetNoteOn(&ch, &note, &vel):
 				if vel > 0 {
-					// Remap CRSS12 notes if needed (32-35 -> 40-43)
-					mappedNote := note
-					if remapped, ok := crss12NoteRemap[note]; ok {
-						mappedNote = remapped
-						debugLog("Spy: ch=%d note=%d->%d vel=%d", ch, note, mappedNote, vel)
+					// Remap spy notes if needed (32-35 -> 40-43)
+					mappedNote := spyNote(remap, note)
+					if mappedNote != note {
+						debugLog("Spy %s: ch=%d note=%d->%d vel=%d", port, ch, note, mappedNote, vel)
+					} else {
+						debugLog("Spy %s: ch=%d note=%d vel=%d", port, ch, note, vel)
+					}
+					notePadChannel(mappedNote, ch)
+					processPadPress(source, mappedNote, vel, timestampms)
+				} else {
+					processPadRelease(source, spyNote(remap, note), 0)
+				}
+			case msg.GetNoteOff(&ch, &note, &vel):
+				processPadRelease(source, spyNote(remap, note), vel)
+			case msg.GetPolyAfterTouch(&ch, &note, &value):
+				handlePadPressure(spyNote(remap, note), value)
+			case msg.GetAfterTouch(&ch, &value):
+				handleChannelPressure(source, value)
+			case msg.GetControlChange(&ch, &cc, &value):
+				// CC toggles: the pad follows the CC, so press it only when
+				// its state has to change (momentary pads press/release)
+				mappedNote, ok := spyCCRemap[cc]
+				if !ok {
+					return
+				}
+				on := value >= spyCCThreshold
+				debugLog("Spy %s: ch=%d CC%d=%d -> pad %d %v", port, ch, cc, value, mappedNote, on)
+				notePadChannel(mappedNote, ch)
+				if momentaryPads[mappedNote] {
+					if on {
+						processPadPress(source, mappedNote, 127, timestampms)
 					} else {
-						debugLog("Spy: ch=%d note=%d vel=%d", ch, note, vel)
+						processPadRelease(source, mappedNote, 0)
 					}
-					processPadPress("CRSS12", mappedNote)
+				} else if on != padIsOn(mappedNote) {
+					processPadPress(source, mappedNote, 127, timestampms)
+					processPadRelease(source, mappedNote, 0)
 				}
 			}
 		}
+	}
 
-		stop, err := midi.ListenTo(spyIn, spyHandler)
+	var stopFuncs []func()
+	inputs := newInputSet()
+	var spyList []string
+
+	// Listen on a spy port (e.g. PLX-CRSS12 button presses); arg is its -spy name
+	var spyOpts []midi.Option
+	if thru != nil {
+		spyOpts = append(spyOpts, midi.UseTimeCode(), midi.UseSysEx())
+	}
+	listenSpy := func(spyIn drivers.In, arg string) error {
+		spyName := spyIn.String()
+		h := newSpyHandler(arg, spyName)
+		stop, err := midi.ListenTo(spyIn, recoverHandler("spy", recorder.wrap(inputSpy, spyName, thru.wrap(h))), spyOpts...)
 		if err != nil {
-			log.Fatalf("Failed to listen to spy port: %v", err)
+			return err
 		}
-		stopFuncs = append(stopFuncs, stop)
-		log.Printf("Spy mode: mirroring button presses from %s", spyPort)
+		inputs.add(spyName, stop)
+		log.Printf("Spy mode: mirroring button presses from %s", spyName)
+		return nil
 	}
 
-	// Listen to all MIDI inputs for LPD8 pad presses
-	inPorts := midi.GetInPorts()
-	for _, inPort := range inPorts {
-		// Skip the spy port to avoid double-handling
-		if spyPort != "" && inPort.String() == spyPort {
+	// Set up a listener for each spy port
+	type spyInput struct{ arg, name string }
+	var spies []spyInput
+	for _, spyPort := range spyPorts {
+		spyIn, err := findInPort(spyPort)
+		if err != nil {
+			log.Fatalf("Spy port not found: %s (%v)", spyPort, err)
+		}
+		if inputs.has(spyIn.String()) {
+			log.Printf("Warning: spy port %s given twice, listening once", spyIn)
 			continue
 		}
-		stop, err := midi.ListenTo(inPort, handler)
+		if err := listenSpy(spyIn, spyPort); err != nil {
+			log.Fatalf("Failed to listen to spy port %s: %v", spyIn, err)
+		}
+		spies = append(spies, spyInput{spyPort, spyIn.String()})
+		spyList = append(spyList, spyIn.String())
+	}
+
+	// The -spy name a port (re)appearing under -watch-inputs belongs to: its
+	// full name from startup, or a -spy name it contains (ALSA client numbers
+	// can change when a device is plugged back in)
+	spyArgFor := func(name string) (string, bool) {
+		for _, spy := range spies {
+			if name == spy.name {
+				return spy.arg, true
+			}
+			// A numeric -spy is a port number, not part of a name
+			if _, err := strconv.Atoi(spy.arg); err != nil && strings.Contains(name, spy.arg) {
+				return spy.arg, true
+			}
+		}
+		return "", false
+	}
+
+	// Listen to all MIDI inputs for LPD8 pad presses
+	// (clock messages are filtered by the driver unless something needs them)
+	var listenOpts []midi.Option
+	if clockIndicatorNote != 0 || clockSync || thru != nil {
+		listenOpts = append(listenOpts, midi.UseTimeCode())
+	}
+	if thru != nil || identify || debugMode {
+		listenOpts = append(listenOpts, midi.UseSysEx())
+	}
+	listenLPD8 := func(inPort drivers.In) {
+		// Skip the feedback port's input side (loopback ports) so feedback
+		// can't come back in as presses
+		if feedbackPort != "" && inPort.String() == feedbackPort {
+			debugLog("Not listening on %s: it's the feedback port", inPort)
+			return
+		}
+		if thru != nil && thru.name != "" && inPort.String() == thru.name {
+			debugLog("Not listening on %s: it's the thru port", inPort)
+			return
+		}
+		stop, err := midi.ListenTo(inPort, recoverHandler("LPD8", recorder.wrap(inputLPD8, inPort.String(), thru.wrap(handler))), listenOpts...)
 		if err != nil {
 			log.Printf("Warning: couldn't listen to %s: %v", inPort, err)
-			continue
+			return
 		}
-		stopFuncs = append(stopFuncs, stop)
+		inputs.add(inPort.String(), stop)
 		log.Printf("Listening on: %s", inPort)
 	}
 
-	if len(stopFuncs) == 0 {
+	inPorts := midi.GetInPorts()
+	if replay != nil {
+		inPorts = nil // The recording stands in for the devices
+	}
+	for _, inPort := range inPorts {
+		// Skip the spy ports to avoid double-handling
+		if inputs.has(inPort.String()) {
+			continue
+		}
+		listenLPD8(inPort)
+	}
+
+	// Attach inputs plugged in later, spies included
+	if watchIns && replay == nil {
+		stopFuncs = append(stopFuncs, watchInputs(ctx, inputs, func(inPort drivers.In) {
+			if arg, ok := spyArgFor(inPort.String()); ok {
+				if err := listenSpy(inPort, arg); err != nil {
+					log.Printf("Warning: couldn't listen to spy port %s: %v", inPort, err)
+				}
+				return
+			}
+			listenLPD8(inPort)
+		}))
+		log.Printf("Watching for new MIDI inputs every %v", inputWatchInterval)
+	}
+	stopFuncs = append(stopFuncs, inputs.Close)
+
+	if replay != nil {
+		// One spy handler per recorded spy port, so each keeps its own remap
+		lpd8Handler := recoverHandler("LPD8", thru.wrap(handler))
+		spyHandlers := make(map[string]func(midi.Message, int32))
+		handlerFor := func(rec recordedMsg) func(midi.Message, int32) {
+			if rec.Input == inputLPD8 {
+				return lpd8Handler
+			}
+			h, ok := spyHandlers[rec.Port]
+			if !ok {
+				h = recoverHandler("spy", thru.wrap(newSpyHandler(rec.Port, rec.Port)))
+				spyHandlers[rec.Port] = h
+			}
+			return h
+		}
+		go replayRecording(ctx, replay, handlerFor)
+		log.Printf("Replaying %d MIDI messages from %s", len(replay), replayPath)
+	} else if inputs.len() == 0 {
 		log.Println("WARNING: No MIDI input ports found!")
 	}
 
+	// Ask the LPD8 who it is now that the reply can be heard
+	if identify {
+		requestIdentity(outputs)
+	}
+
+	// Optional HTTP API and Prometheus metrics
+	if httpAddr != "" {
+		stopFuncs = append(stopFuncs, startHTTPServer(ctx, httpAddr))
+	}
+	if metricsAddr != "" {
+		stopFuncs = append(stopFuncs, serveHTTP(ctx, metricsAddr, newMetricsHandler()))
+		log.Printf("Prometheus metrics on %s/metrics", metricsAddr)
+	}
+
 	log.Println("")
 	log.Printf("LPD8 LED Bridge running")
-	log.Printf("Sending to: %s", outputPort)
-	if spyPort != "" {
-		log.Printf("Mirroring: %s", spyPort)
+	if dryRun {
+		log.Printf("Sending to: stdout (dry run)")
+	} else {
+		log.Printf("Sending to: %s", outputPorts.String())
+	}
+	if len(spyList) > 0 {
+		log.Printf("Mirroring: %s", strings.Join(spyList, ", "))
 	}
 	log.Println("Press Ctrl+C to exit")
 
+	// Reload config on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hupChan:
+				reloadConfig(activeConfigPath(configPath))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Dump state to stderr on SIGUSR1
+	watchDumpSignal(ctx, configPath)
+
 	// Wait for interrupt
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	if trayMode {
+		runTray(ctx, configPath) // Returns on Quit too
+	} else if tuiMode {
+		if err := runTUI(ctx); err != nil { // Returns on q too
+			log.Printf("TUI failed: %v", err)
+			<-ctx.Done()
+		}
+	} else {
+		<-ctx.Done()
+	}
+	cancel() // Stop everything, also when the tray/TUI quit
 
+	// Stop the MIDI inputs and the HTTP API first, so nothing changes the
+	// grid while it's saved and the last frames go out
 	for _, stop := range stopFuncs {
 		stop()
 	}
+	seq.Close()
+	stopSaver()
+	// Save while padState is still the live grid: the -off-on-exit
+	// blackout below only goes to the LEDs, and must come after
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			log.Printf("Failed to save state: %v", err)
+		} else {
+			log.Printf("Saved pad state to: %s", stateFile)
+		}
+	}
+	stopRefresh()
+	stopBlink()
+	stopTempo()
+	stopFrames()
+
+	// Go dark so the LPD8 doesn't look live once nothing drives it
+	// (must happen before the deferred midi.CloseDriver). Encoded directly,
+	// as renderColors would draw overlays (knob preview, reload flash) over
+	// an all-off grid.
+	if offOnExit {
+		if err := sender.Send(renderer.BuildSysEx([8]Color{})); err != nil {
+			log.Printf("Error turning LEDs off: %v", err)
+		}
+	}
+
 	log.Println("Shutting down...")
 }
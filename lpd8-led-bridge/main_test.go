@@ -0,0 +1,362 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lpd8-led-bridge/pkg/lpd8"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestRecoverHandler(t *testing.T) {
+	var handled []uint8
+	h := recoverHandler("test", func(msg midi.Message, _ int32) {
+		var ch, key, vel uint8
+		if msg.GetNoteOn(&ch, &key, &vel) && key == 0 {
+			panic("bad note")
+		}
+		handled = append(handled, key)
+	})
+
+	before := recoveredPanics.Load()
+	h(midi.NoteOn(0, 36, 127), 0)
+	h(midi.NoteOn(0, 0, 127), 0) // Panics
+	h(midi.NoteOn(0, 37, 127), 0)
+
+	if got := recoveredPanics.Load() - before; got != 1 {
+		t.Errorf("recoveredPanics went up by %d, want 1", got)
+	}
+	if want := []uint8{36, 37}; !slices.Equal(handled, want) {
+		t.Errorf("handled %v, want %v (messages after the panic should still be processed)", handled, want)
+	}
+}
+
+// fakeSender records every message sent through it
+type fakeSender struct {
+	sent [][]byte
+}
+
+func (f *fakeSender) Send(data []byte) error {
+	f.sent = append(f.sent, slices.Clone(data))
+	return nil
+}
+
+// The pad colors of the last message sent
+func (f *fakeSender) last(t *testing.T) [8]Color {
+	t.Helper()
+	if len(f.sent) == 0 {
+		t.Fatal("nothing sent")
+	}
+	colors, ok := decodeSysEx(f.sent[len(f.sent)-1])
+	if !ok {
+		t.Fatalf("last message isn't an LED update: % X", f.sent[len(f.sent)-1])
+	}
+	return colors
+}
+
+// Reset the mappings to the default config and the pads to their initial
+// state: top row (blues 40-43) on, bottom row (ambers 36-39) off
+func resetPads(t *testing.T) {
+	t.Helper()
+	stateMutex.Lock()
+	buildMappings(defaultConfig())
+	stateMutex.Unlock()
+	resetPadStates()
+}
+
+// Put the pads of the current mappings in their initial state
+func resetPadStates() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	clear(padState)
+	clear(padSource)
+	for note, pos := range noteToPayloadPos {
+		padState[note] = initialPadOn(note)
+		if padState[note] {
+			padColors[pos] = onColor(note)
+		} else {
+			padColors[pos] = colorOff
+		}
+	}
+}
+
+func TestHandleAmberPress(t *testing.T) {
+	resetPads(t)
+	out := &fakeSender{}
+
+	// Amber 37 (pad 2) on turns its blues 41-43 (pads 6-8) off in one message
+	handleAmberPress(out, 37, 127)
+	if len(out.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(out.sent))
+	}
+	want := [8]Color{colorOff, colorBottomRow, colorOff, colorOff, colorTopRow, colorOff, colorOff, colorOff}
+	if got := out.last(t); got != want {
+		t.Errorf("after amber on: %v, want %v", got, want)
+	}
+
+	// And off again turns them back on
+	handleAmberPress(out, 37, 127)
+	want = [8]Color{colorOff, colorOff, colorOff, colorOff, colorTopRow, colorTopRow, colorTopRow, colorTopRow}
+	if got := out.last(t); got != want {
+		t.Errorf("after amber off: %v, want %v", got, want)
+	}
+}
+
+func TestHandleBluePress(t *testing.T) {
+	resetPads(t)
+	out := &fakeSender{}
+
+	handleAmberPress(out, 36, 127) // Amber 36 on, blue 40 off
+	handleBluePress(out, 40, 127)  // Blue 40 back on turns amber 36 off
+
+	if len(out.sent) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(out.sent))
+	}
+	want := [8]Color{colorOff, colorOff, colorOff, colorOff, colorTopRow, colorTopRow, colorTopRow, colorTopRow}
+	if got := out.last(t); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSetPad(t *testing.T) {
+	resetPads(t)
+	out := &fakeSender{}
+
+	setPad(out, 40, true) // Already on
+	if len(out.sent) != 0 {
+		t.Fatalf("setting a pad to its current state sent %d messages", len(out.sent))
+	}
+
+	setPad(out, 40, false)
+	if got := out.last(t); got[4] != colorOff {
+		t.Errorf("pad 40 shows %v, want off", got[4])
+	}
+	setPad(out, 36, true)
+	if got := out.last(t); got[0] != colorBottomRow {
+		t.Errorf("pad 36 shows %v, want %v", got[0], colorBottomRow)
+	}
+}
+
+func TestTogglePad(t *testing.T) {
+	resetPads(t)
+	out := &fakeSender{}
+
+	togglePad(out, 41)
+	togglePad(out, 41)
+	togglePad(out, 99) // Not a pad
+
+	if len(out.sent) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(out.sent))
+	}
+	first, _ := decodeSysEx(out.sent[0])
+	if first[5] != colorOff {
+		t.Errorf("after first toggle pad 41 shows %v, want off", first[5])
+	}
+	if got := out.last(t); got[5] != colorTopRow {
+		t.Errorf("after second toggle pad 41 shows %v, want %v", got[5], colorTopRow)
+	}
+}
+
+func TestHandleKnobChange(t *testing.T) {
+	resetPads(t)
+	out := &fakeSender{}
+
+	// Knob 1 (CC 70) drives blue 40: down turns it off, up lights it dimmed
+	handleKnobChange(out, 70, 0)
+	if got := out.last(t); got[4] != colorOff {
+		t.Errorf("knob at 0: pad 40 shows %v, want off", got[4])
+	}
+	handleKnobChange(out, 70, 32)
+	got := out.last(t)
+	if got[4] == colorOff || got[4].B >= colorTopRow.B {
+		t.Errorf("knob at 32: pad 40 shows %v, want dimmed %v", got[4], colorTopRow)
+	}
+	handleKnobChange(out, 70, 127)
+	if got := out.last(t); got[4] != colorTopRow {
+		t.Errorf("knob at 127: pad 40 shows %v, want %v", got[4], colorTopRow)
+	}
+
+	// CCs without a mapping send nothing
+	n := len(out.sent)
+	handleKnobChange(out, 99, 127)
+	if len(out.sent) != n {
+		t.Errorf("unmapped CC sent %d messages", len(out.sent)-n)
+	}
+}
+
+func TestSplitPads(t *testing.T) {
+	red, green := Color{R: 127}, Color{G: 127}
+	cfg := defaultConfig()
+	cfg.SplitPads = map[string][2]Color{"40": {red, green}, "36": {red, green}}
+	stateMutex.Lock()
+	buildMappings(cfg)
+	stateMutex.Unlock()
+	resetPadStates()
+	defer resetPads(t)
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	// Swaps once per interval, pads that are off stay off
+	start := time.Now()
+	splitNext = start
+	var seen []Color
+	for i := 0; i < 4; i++ {
+		now := start.Add(time.Duration(i) * splitInterval)
+		if !advanceSplitLocked(now) {
+			t.Fatalf("step %d: no swap after splitInterval", i)
+		}
+		if advanceSplitLocked(now.Add(splitInterval / 2)) {
+			t.Fatalf("step %d: swapped again within splitInterval", i)
+		}
+		colors := renderColors(padColors)
+		if colors[0] != colorOff {
+			t.Errorf("step %d: unlit split pad 36 shows %v", i, colors[0])
+		}
+		seen = append(seen, colors[4])
+	}
+	if want := []Color{green, red, green, red}; !slices.Equal(seen, want) {
+		t.Errorf("pad 40 showed %v, want %v", seen, want)
+	}
+}
+
+func TestCyclePalette(t *testing.T) {
+	red, green := Color{R: 127}, Color{G: 127}
+	cfg := defaultConfig()
+	cfg.PaletteCycleNote = 43
+	cfg.Palettes = [][8]Color{
+		{4: red},
+		{4: green},
+	}
+	stateMutex.Lock()
+	buildMappings(cfg)
+	stateMutex.Unlock()
+	resetPadStates()
+	defer resetPads(t)
+
+	stateMutex.Lock()
+	padState[40] = true
+	padColors[4] = onColor(40)
+	normal := padColors[4]
+	stateMutex.Unlock()
+
+	// Steps through both palettes, then wraps back to the normal colors
+	for i, want := range []Color{red, green, normal, red} {
+		cyclePalette()
+		stateMutex.Lock()
+		got, lit := padColors[4], padState[43]
+		stateMutex.Unlock()
+		if got != want {
+			t.Errorf("press %d: pad 40 = %v, want %v", i+1, got, want)
+		}
+		if wantLit := want != normal; lit != wantLit {
+			t.Errorf("press %d: cycle pad lit = %v, want %v", i+1, lit, wantLit)
+		}
+	}
+	if paletteIndex != 1 {
+		t.Errorf("paletteIndex = %d after 4 presses, want 1", paletteIndex)
+	}
+}
+
+// Run with -race: a reload swapping the mappings while HTTP and OSC
+// requests read them
+func TestApplyConfigConcurrentReaders(t *testing.T) {
+	defer resetPads(t)
+
+	moved := defaultConfig()
+	moved.LPD8.TopRow, moved.LPD8.BottomRow = moved.LPD8.BottomRow, moved.LPD8.TopRow
+	moved.KnobToBlue = map[string]int{"70": 36}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	reader := func(read func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					read()
+				}
+			}
+		}()
+	}
+	reader(func() {
+		req := httptest.NewRequest("POST", "/pad/40", strings.NewReader(`{"on": true}`))
+		newHTTPHandler().ServeHTTP(httptest.NewRecorder(), req)
+	})
+	reader(func() {
+		(&oscServer{}).handle("/pad/36", []float64{1})
+	})
+
+	for i := 0; i < 200; i++ {
+		if i%2 == 0 {
+			applyConfig(moved)
+		} else {
+			applyConfig(defaultConfig())
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestRendererFor(t *testing.T) {
+	r, err := rendererFor(variantMK2)
+	if err != nil {
+		t.Fatalf("rendererFor(%q): %v", variantMK2, err)
+	}
+	colors := [8]Color{{R: 127}, {G: 64}, {B: 1}, {}, {}, {}, {}, {R: 1, G: 2, B: 3}}
+	if got, want := r.BuildSysEx(colors), lpd8.SysEx(colors); !slices.Equal(got, want) {
+		t.Errorf("mk2 SysEx = % X, want % X", got, want)
+	}
+
+	// No MK1 renderer: its LEDs can't be set, so it's refused by name
+	for _, variant := range []string{variantMK1, "mk3", ""} {
+		if _, err := rendererFor(variant); err == nil {
+			t.Errorf("rendererFor(%q) succeeded, want an error", variant)
+		}
+	}
+	if _, err := rendererFor(variantMK1); err == nil || !strings.Contains(err.Error(), "can't be set") {
+		t.Errorf("rendererFor(%q) error = %v, want the unsupported reason", variantMK1, err)
+	}
+}
+
+func TestKnobToggleStep(t *testing.T) {
+	const cc = 90
+	defer delete(knobToggleLast, cc)
+
+	type step struct{ release, press bool }
+	for i, tc := range []struct {
+		value uint8
+		want  step
+	}{
+		{127, step{press: true}},  // Up: press
+		{100, step{}},             // Still up: held
+		{0, step{release: true}},  // Down: release
+		{10, step{}},              // Still down
+		{64, step{press: true}},   // At the threshold: press
+		{63, step{release: true}}, // Just under: release
+		{127, step{press: true}},  // Up again
+	} {
+		release, press := knobToggleStep(cc, tc.value)
+		if got := (step{release, press}); got != tc.want {
+			t.Errorf("step %d: value %d = %+v, want %+v", i, tc.value, got, tc.want)
+		}
+	}
+
+	// Quiet while held: a release and a new press
+	knobToggleMutex.Lock()
+	knobToggleLast[cc] = time.Now().Add(-2 * knobToggleDebounce)
+	knobToggleMutex.Unlock()
+	if release, press := knobToggleStep(cc, 127); !release || !press {
+		t.Errorf("after %v quiet: release=%v press=%v, want both", 2*knobToggleDebounce, release, press)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Prometheus metrics (-metrics ADDR): GET /metrics in the text exposition
+// format. Handlers only bump atomic counters, so the MIDI path never waits
+// on a scrape; the pads-on gauge is counted when scraped.
+
+var (
+	metricPadPresses  atomic.Uint64 // Accepted pad presses, any source
+	metricKnobChanges atomic.Uint64 // Knob CCs handled
+	metricSysExSent   atomic.Uint64 // LED frames sent
+	metricSendErrors  atomic.Uint64 // LED frames that failed to send
+	metricSpyEvents   atomic.Uint64 // Messages from the spy input
+)
+
+func newMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", handleMetrics)
+	return mux
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("lpd8_bridge_pad_presses_total", "Pad presses handled, from any source.", metricPadPresses.Load())
+	counter("lpd8_bridge_knob_changes_total", "Knob CC messages handled.", metricKnobChanges.Load())
+	counter("lpd8_bridge_sysex_sent_total", "LED SysEx messages sent.", metricSysExSent.Load())
+	counter("lpd8_bridge_send_errors_total", "LED SysEx messages that failed to send.", metricSendErrors.Load())
+	counter("lpd8_bridge_spy_events_total", "MIDI messages received from the spy input.", metricSpyEvents.Load())
+	counter("lpd8_bridge_recovered_panics_total", "Panics recovered in MIDI handlers.", recoveredPanics.Load())
+
+	stateMutex.Lock()
+	on := 0
+	for note := range noteToPayloadPos {
+		if padState[note] {
+			on++
+		}
+	}
+	stateMutex.Unlock()
+	fmt.Fprintf(w, "# HELP lpd8_bridge_pads_on Pads currently on.\n# TYPE lpd8_bridge_pads_on gauge\nlpd8_bridge_pads_on %d\n", on)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OSC control surface (e.g. TouchOSC) over UDP
+//
+//	/pad/{note} 1   -> pad on   (int or float argument, non-zero = on)
+//	/pad/{note} 0   -> pad off
+//
+// Every pad state change, whatever caused it, is sent back as /pad/{note} 0|1
+// so OSC widgets follow MIDI presses. Replies go to -osc-out if set, else to
+// the address the last OSC message came from.
+
+type oscServer struct {
+	conn *net.UDPConn
+
+	mu   sync.Mutex
+	out  *net.UDPAddr   // Where state changes are sent (nil until known)
+	sent map[uint8]bool // Pad states last sent
+	fix  bool           // out came from -osc-out (don't follow clients)
+}
+
+// Listen for OSC on addr; outAddr ("" = reply to the last client) receives
+// state changes
+func startOSCServer(addr, outAddr string) (*oscServer, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &oscServer{conn: conn, sent: make(map[uint8]bool)}
+	if outAddr != "" {
+		if s.out, err = net.ResolveUDPAddr("udp", outAddr); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		s.fix = true
+	}
+
+	go s.serve()
+	log.Printf("OSC listening on %s", conn.LocalAddr())
+	return s, nil
+}
+
+func (s *oscServer) Close() {
+	s.conn.Close()
+}
+
+func (s *oscServer) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("OSC read error: %v", err)
+			}
+			return
+		}
+
+		if !s.fix {
+			s.mu.Lock()
+			newClient := s.out == nil || s.out.String() != from.String()
+			if newClient {
+				s.out = from
+				s.sent = make(map[uint8]bool)
+			}
+			s.mu.Unlock()
+			if newClient {
+				debugLog("OSC: new client %s", from)
+				resendFrame() // Sends it the full state
+			}
+		}
+
+		address, args, err := parseOSC(buf[:n])
+		if err != nil {
+			debugLog("OSC: ignoring packet from %s: %v", from, err)
+			continue
+		}
+		s.handle(address, args)
+	}
+}
+
+// Handle one OSC message
+func (s *oscServer) handle(address string, args []float64) {
+	mappingsMutex.RLock()
+	defer mappingsMutex.RUnlock()
+
+	noteStr, ok := strings.CutPrefix(address, "/pad/")
+	n, err := strconv.Atoi(noteStr)
+	if !ok || err != nil || n < 0 || n > 127 || len(args) < 1 {
+		debugLog("OSC: ignoring %s %v", address, args)
+		return
+	}
+	note := uint8(n)
+	if _, ok := noteToPayloadPos[note]; !ok {
+		debugLog("OSC: ignoring unknown pad %d", note)
+		return
+	}
+
+	debugLog("OSC: pad %d -> %v", note, args[0] != 0)
+	setPad(ledOut, note, args[0] != 0)
+}
+
+// Send changed pad states to the OSC client
+func (s *oscServer) sendState() {
+	snap := snapshotState()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.out == nil {
+		return
+	}
+	for key, on := range snap.PadState {
+		n, _ := strconv.Atoi(key)
+		note := uint8(n)
+		if prev, ok := s.sent[note]; ok && prev == on {
+			continue
+		}
+		value := int32(0)
+		if on {
+			value = 1
+		}
+		if _, err := s.conn.WriteToUDP(encodeOSC(fmt.Sprintf("/pad/%d", note), value), s.out); err != nil {
+			debugLog("OSC: send to %s failed: %v", s.out, err)
+			return
+		}
+		s.sent[note] = on
+	}
+}
+
+// Parse an OSC message into its address and numeric arguments
+// (int32, float32 and the T/F booleans; other types are skipped)
+func parseOSC(packet []byte) (string, []float64, error) {
+	address, rest, err := readOSCString(packet)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.HasPrefix(address, "/") {
+		return "", nil, fmt.Errorf("not an OSC message (bundles aren't supported)")
+	}
+	if len(rest) == 0 {
+		return address, nil, nil // No type tags
+	}
+	tags, rest, err := readOSCString(rest)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return "", nil, fmt.Errorf("bad type tags %q", tags)
+	}
+
+	var args []float64
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return "", nil, fmt.Errorf("truncated argument")
+			}
+			v := binary.BigEndian.Uint32(rest)
+			rest = rest[4:]
+			if tag == 'i' {
+				args = append(args, float64(int32(v)))
+			} else {
+				args = append(args, float64(math.Float32frombits(v)))
+			}
+		case 'T':
+			args = append(args, 1)
+		case 'F':
+			args = append(args, 0)
+		default:
+			return address, args, nil // Stop at types we don't read
+		}
+	}
+	return address, args, nil
+}
+
+// Read a null-terminated string padded to a multiple of 4 bytes
+func readOSCString(b []byte) (string, []byte, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated string")
+	}
+	size := (end + 4) &^ 3
+	if size > len(b) {
+		return "", nil, fmt.Errorf("truncated string")
+	}
+	return string(b[:end]), b[size:], nil
+}
+
+// Encode an OSC message with one int32 argument
+func encodeOSC(address string, value int32) []byte {
+	var buf bytes.Buffer
+	writeOSCString(&buf, address)
+	writeOSCString(&buf, ",i")
+	binary.Write(&buf, binary.BigEndian, value)
+	return buf.Bytes()
+}
+
+func writeOSCString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.Write(make([]byte, 4-len(s)%4)) // Null terminator plus padding
+}
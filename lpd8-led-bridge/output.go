@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// Reconnect backoff: first retry after reconnectMin, doubling up to reconnectMax
+const (
+	reconnectMin = 1 * time.Second
+	reconnectMax = 30 * time.Second
+)
+
+// LED output port that can reconnect after the device is unplugged
+type ledOutput struct {
+	ctx       context.Context // Reconnecting gives up when this is done
+	name      string
+	reconnect bool
+
+	mu           sync.Mutex
+	port         drivers.Out
+	send         func(msg midi.Message) error // nil while disconnected
+	reconnecting bool
+}
+
+func newLEDOutput(ctx context.Context, name string, port drivers.Out, send func(msg midi.Message) error, reconnect bool) *ledOutput {
+	return &ledOutput{ctx: ctx, name: name, reconnect: reconnect, port: port, send: send}
+}
+
+// Send a SysEx message; on failure, start reconnecting in the background
+func (o *ledOutput) Send(data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.send == nil {
+		return fmt.Errorf("output %s disconnected", o.name)
+	}
+
+	err := o.send(data)
+	if err != nil && o.reconnect && !o.reconnecting {
+		log.Printf("Output %s failed (%v), reconnecting...", o.name, err)
+		o.send = nil
+		if o.port != nil {
+			o.port.Close()
+			o.port = nil
+		}
+		o.reconnecting = true
+		go o.reconnectLoop()
+	}
+	return err
+}
+
+// Retry opening the port with backoff, then resend the full LED state
+func (o *ledOutput) reconnectLoop() {
+	delay := reconnectMin
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-o.ctx.Done():
+			return
+		}
+		log.Printf("Reconnect attempt %d: %s", attempt, o.name)
+
+		port, err := findOutPort(o.name)
+		if err == nil {
+			var send func(msg midi.Message) error
+			send, err = midi.SendTo(port)
+			if err == nil {
+				o.mu.Lock()
+				o.port = port
+				o.send = send
+				o.reconnecting = false
+				o.mu.Unlock()
+				log.Printf("Reconnected to %s after %d attempt(s)", o.name, attempt)
+				o.resendState()
+				return
+			}
+		}
+		debugLog("Reconnect to %s failed: %v", o.name, err)
+
+		delay = min(delay*2, reconnectMax)
+	}
+}
+
+// Resend the full current pad state after reconnecting
+func (o *ledOutput) resendState() {
+	resendFrame()
+}
+
+// Several LED outputs showing the same state (e.g. two LPD8s side by side)
+type ledOutputs []*ledOutput
+
+// Send the SysEx to every output; a failing output doesn't stop the others,
+// and the returned error names each one that failed
+func (outs ledOutputs) Send(data []byte) error {
+	var errs []error
+	for _, o := range outs {
+		if err := o.Send(data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Output port names from -out, which can be repeated or comma-separated
+type portList []string
+
+func (p *portList) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, ", ")
+}
+
+func (p *portList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*p = append(*p, name)
+		}
+	}
+	return nil
+}
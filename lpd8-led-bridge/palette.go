@@ -0,0 +1,71 @@
+package main
+
+import "log"
+
+// Palette cycling (palette_cycle_note): each press of the pad switches to
+// the next of the configured palettes, each one an on color for every pad
+// (pads 1-8, bottom row first), and after the last back to the normal
+// colors. Lit pads are recolored in one update. The pad is lit while a
+// palette is active.
+
+// Set from config
+var (
+	paletteCycleNote uint8
+	palettes         [][8]Color
+)
+
+// Active palette, 1-based (0 = the normal colors); guarded by stateMutex
+var paletteIndex int
+
+// Whether a note is the palette cycle pad
+func isPaletteCycleNote(note uint8) bool {
+	return paletteCycleNote != 0 && note == paletteCycleNote
+}
+
+// The active palette's color for a pad, if a palette is active
+// Caller must hold stateMutex
+func paletteColor(note uint8) (Color, bool) {
+	if paletteIndex == 0 || paletteIndex > len(palettes) {
+		return Color{}, false
+	}
+	pos, ok := noteToPayloadPos[note]
+	if !ok {
+		return Color{}, false
+	}
+	return palettes[paletteIndex-1][pos], true
+}
+
+// Switch to the next palette, wrapping around to the normal colors
+func cyclePalette() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	paletteIndex = (paletteIndex + 1) % (len(palettes) + 1)
+	applyPaletteLocked()
+	queueSend()
+
+	if paletteIndex == 0 {
+		log.Println("Palette: normal colors")
+	} else {
+		log.Printf("Palette %d of %d", paletteIndex, len(palettes))
+	}
+}
+
+// Recolor every lit pad for the active palette and light the cycle pad
+// while a palette is active
+// Caller holds stateMutex and sends the update
+func applyPaletteLocked() {
+	for note, pos := range noteToPayloadPos {
+		if reservedPads[note] || !padState[note] {
+			continue
+		}
+		padColors[pos] = onColor(note)
+	}
+	if pos, ok := noteToPayloadPos[paletteCycleNote]; ok {
+		padState[paletteCycleNote] = paletteIndex > 0
+		padColors[pos] = colorOff
+		if paletteIndex > 0 {
+			padColors[pos] = onColor(paletteCycleNote)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "log"
+
+// Panic control: a note or CC (panic_note / panic_cc) that, from any input,
+// puts every pad straight back to its initial state in a single SysEx. It
+// isn't a press, so toggling, debounce and long presses don't apply.
+
+// Set from config (0 = none)
+var (
+	panicNote uint8
+	panicCC   uint8
+)
+
+// Values at/above which a trigger CC (panic_cc, undo_cc) fires, like a
+// button press
+const triggerCCThreshold = 64
+
+// Whether a Note On is the panic note
+func isPanicNote(note uint8, vel uint8) bool {
+	return panicNote != 0 && note == panicNote && vel > 0
+}
+
+// Whether a CC is the panic CC being pressed
+func isPanicCC(cc uint8, value uint8) bool {
+	return panicCC != 0 && cc == panicCC && value >= triggerCCThreshold
+}
+
+// Reset every pad to its initial state, skipping fades, and send it at once
+func panicReset(source string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pushUndoLocked()
+	for note, pos := range noteToPayloadPos {
+		if reservedPads[note] {
+			continue // Feature pads keep showing their feature
+		}
+		padSource[note] = ""
+		padState[note] = initialPadOn(note)
+		if padState[note] {
+			padColors[pos] = onColor(note)
+		} else {
+			padColors[pos] = colorOff
+		}
+		fades[pos] = padFade{from: padColors[pos], to: padColors[pos]}
+	}
+	queueSend()
+
+	log.Printf("Panic from %s: all pads reset", source)
+}
@@ -0,0 +1,75 @@
+// Package lpd8 holds the Akai LPD8 MK2 LED protocol used by the
+// lpd8-led-bridge command, for programs that already own their MIDI ports:
+// pad colors, their SysEx encoding and decoding, and the Sender the
+// encoded messages go to. The pad state machine (config, mappings, press
+// and knob handling) stays in the command and isn't exported; programs that
+// want it drive a running bridge over its HTTP or OSC API.
+package lpd8
+
+import "math"
+
+// Color is a pad LED color, each channel 0-127
+type Color struct {
+	R byte `json:"r" yaml:"r"`
+	G byte `json:"g" yaml:"g"`
+	B byte `json:"b" yaml:"b"`
+}
+
+// Default colors
+var (
+	Off   = Color{0, 0, 0}    // LED off (black)
+	Blue  = Color{0, 0, 127}  // Top row (stem on/off)
+	Amber = Color{127, 40, 0} // Bottom row (FX)
+)
+
+// ScaleColor scales a full on-color by a velocity or brightness (127 =
+// full). Channels are rounded and clamped to 0-127, and a lit channel never
+// rounds down to zero so a dim pad doesn't look off.
+func ScaleColor(c Color, vel uint8) Color {
+	scale := func(v byte) byte {
+		if v == 0 {
+			return 0
+		}
+		scaled := (int(v)*int(min(vel, 127)) + 63) / 127
+		return byte(min(max(scaled, 1), 127))
+	}
+	return Color{scale(c.R), scale(c.G), scale(c.B)}
+}
+
+// HueColor is the fully saturated, full value color for a hue in degrees
+// (0 = red, 120 = green, 240 = blue)
+func HueColor(hue float64) Color {
+	hue = math.Mod(hue, 360)
+	if hue < 0 {
+		hue += 360
+	}
+	sector := int(hue / 60)          // 0-5
+	rise := hue/60 - float64(sector) // 0-1 within the sector
+	up := byte(math.Round(rise * 127))
+	down := 127 - up
+
+	switch sector {
+	case 0:
+		return Color{127, up, 0} // Red -> yellow
+	case 1:
+		return Color{down, 127, 0} // Yellow -> green
+	case 2:
+		return Color{0, 127, up} // Green -> cyan
+	case 3:
+		return Color{0, down, 127} // Cyan -> blue
+	case 4:
+		return Color{up, 0, 127} // Blue -> magenta
+	default:
+		return Color{127, 0, down} // Magenta -> red
+	}
+}
+
+// GammaTable builds a brightness lookup table of 127 * (v/127)^gamma; 0 and
+// 127 map to themselves and the table never decreases (gamma 1 is linear)
+func GammaTable(gamma float64) [128]uint8 {
+	var table [128]uint8
+	for v := range table {
+		table[v] = uint8(math.Round(127 * math.Pow(float64(v)/127, gamma)))
+	}
+	return table
+}
@@ -0,0 +1,50 @@
+package lpd8
+
+import "testing"
+
+func TestHueColor(t *testing.T) {
+	tests := []struct {
+		hue  float64
+		want Color
+	}{
+		{0, Color{R: 127}},
+		{120, Color{G: 127}},
+		{240, Color{B: 127}},
+		{60, Color{R: 127, G: 127}},
+		{360, Color{R: 127}},  // Wraps to red
+		{480, Color{G: 127}},  // 360 + 120
+		{-120, Color{B: 127}}, // 360 - 120
+		{-360, Color{R: 127}},
+	}
+	for _, tt := range tests {
+		if got := HueColor(tt.hue); got != tt.want {
+			t.Errorf("HueColor(%v) = %v, want %v", tt.hue, got, tt.want)
+		}
+	}
+}
+
+func TestGammaTable(t *testing.T) {
+	for _, gamma := range []float64{0.5, 1, 1.8, 2.2, 3} {
+		table := GammaTable(gamma)
+		if table[0] != 0 || table[127] != 127 {
+			t.Errorf("GammaTable(%v) endpoints = %d, %d, want 0, 127", gamma, table[0], table[127])
+		}
+		for v := 1; v < len(table); v++ {
+			if table[v] < table[v-1] {
+				t.Errorf("GammaTable(%v) decreases at %d: %d -> %d", gamma, v, table[v-1], table[v])
+				break
+			}
+		}
+	}
+
+	// Gamma 1 is linear
+	for v, got := range GammaTable(1) {
+		if int(got) != v {
+			t.Errorf("GammaTable(1)[%d] = %d, want %d", v, got, v)
+		}
+	}
+	// Above 1 dims the low end
+	if table := GammaTable(2.2); table[64] >= 64 {
+		t.Errorf("GammaTable(2.2)[64] = %d, want below 64", table[64])
+	}
+}
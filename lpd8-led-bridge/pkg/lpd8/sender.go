@@ -0,0 +1,14 @@
+package lpd8
+
+// Sender takes complete LED SysEx messages, e.g. a MIDI output port
+type Sender interface {
+	Send(data []byte) error
+}
+
+// SenderFunc adapts a function to a Sender
+type SenderFunc func(data []byte) error
+
+// Send calls f(data)
+func (f SenderFunc) Send(data []byte) error {
+	return f(data)
+}
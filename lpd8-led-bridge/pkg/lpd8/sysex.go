@@ -0,0 +1,58 @@
+package lpd8
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LPD8 MK2 LED SysEx: SysExHeader, then 6 bytes per pad in payload order
+// (pads 1-4 bottom row, then 5-8 top row), each color channel as a high byte
+// (always 0) and a low byte (0-127), then SysExFooter
+var (
+	SysExHeader = []byte{0xF0, 0x47, 0x7F, 0x4C, 0x06, 0x00, 0x30}
+	SysExFooter = []byte{0xF7}
+)
+
+// PayloadSize is the length of the color payload, 6 bytes for each of the 8 pads
+const PayloadSize = 48
+
+// Payload encodes the 8 pad colors as the SysEx payload
+func Payload(colors [8]Color) []byte {
+	payload := make([]byte, 0, PayloadSize)
+	for _, c := range colors {
+		payload = append(payload, 0x00, c.R, 0x00, c.G, 0x00, c.B)
+	}
+	return payload
+}
+
+// SysEx builds the complete LED SysEx message for the 8 pad colors
+func SysEx(colors [8]Color) []byte {
+	msg := make([]byte, 0, len(SysExHeader)+PayloadSize+len(SysExFooter))
+	msg = append(msg, SysExHeader...)
+	msg = append(msg, Payload(colors)...)
+	msg = append(msg, SysExFooter...)
+	return msg
+}
+
+// DecodeSysEx reads the pad colors back out of a message built by SysEx. It
+// fails if the message isn't an LED update in that format: wrong length,
+// header or footer, non-zero high bytes, or data bytes with the top bit set
+// (which would break SysEx framing).
+func DecodeSysEx(msg []byte) ([8]Color, error) {
+	var colors [8]Color
+	if want := len(SysExHeader) + PayloadSize + len(SysExFooter); len(msg) != want {
+		return colors, fmt.Errorf("length %d, want %d", len(msg), want)
+	}
+	if !bytes.HasPrefix(msg, SysExHeader) || !bytes.HasSuffix(msg, SysExFooter) {
+		return colors, fmt.Errorf("unexpected header/footer % X", msg)
+	}
+	payload := msg[len(SysExHeader) : len(SysExHeader)+PayloadSize]
+	for i := range colors {
+		p := payload[i*6 : i*6+6]
+		if p[0] != 0 || p[2] != 0 || p[4] != 0 || p[1] > 127 || p[3] > 127 || p[5] > 127 {
+			return [8]Color{}, fmt.Errorf("bad color bytes for pad %d: % X", i, p)
+		}
+		colors[i] = Color{p[1], p[3], p[5]}
+	}
+	return colors, nil
+}
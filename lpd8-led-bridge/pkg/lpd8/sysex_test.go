@@ -0,0 +1,134 @@
+package lpd8
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuildPayload(t *testing.T) {
+	white := Color{R: 127, G: 127, B: 127}
+	tests := []struct {
+		name   string
+		colors [8]Color
+		want   []byte
+	}{
+		{
+			name: "all off",
+			want: make([]byte, PayloadSize),
+		},
+		{
+			name:   "full white",
+			colors: [8]Color{white, white, white, white, white, white, white, white},
+			want: slices.Concat(
+				[]byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F}, []byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F},
+				[]byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F}, []byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F},
+				[]byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F}, []byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F},
+				[]byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F}, []byte{0x00, 0x7F, 0x00, 0x7F, 0x00, 0x7F},
+			),
+		},
+		{
+			name:   "00 R 00 G 00 B per pad, in pad order",
+			colors: [8]Color{{R: 1, G: 2, B: 3}, Blue, Amber, Off, Off, Off, Off, {R: 0x7F, G: 0x10, B: 0x20}},
+			want: slices.Concat(
+				[]byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x03},
+				[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x7F},
+				[]byte{0x00, Amber.R, 0x00, Amber.G, 0x00, Amber.B},
+				make([]byte, 4*6),
+				[]byte{0x00, 0x7F, 0x00, 0x10, 0x00, 0x20},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Payload(tt.colors)
+			if len(got) != PayloadSize || PayloadSize != 48 {
+				t.Fatalf("payload is %d bytes (PayloadSize %d), want 48", len(got), PayloadSize)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Payload(%v) =\n% X\nwant\n% X", tt.colors, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSysEx(t *testing.T) {
+	white := Color{R: 127, G: 127, B: 127}
+	header := []byte{0xF0, 0x47, 0x7F, 0x4C, 0x06, 0x00, 0x30}
+	tests := []struct {
+		name   string
+		colors [8]Color
+	}{
+		{"all off", [8]Color{}},
+		{"full white", [8]Color{white, white, white, white, white, white, white, white}},
+		{"mixed", [8]Color{Amber, Amber, Off, Off, Blue, Blue, {R: 5}, {G: 6}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SysEx(tt.colors)
+			if len(got) != 56 {
+				t.Fatalf("message is %d bytes, want 56", len(got))
+			}
+			if !slices.Equal(got[:7], header) {
+				t.Errorf("header % X, want % X", got[:7], header)
+			}
+			if !slices.Equal(got[7:55], Payload(tt.colors)) {
+				t.Errorf("payload % X, want % X", got[7:55], Payload(tt.colors))
+			}
+			if got[55] != 0xF7 {
+				t.Errorf("last byte %02X, want F7", got[55])
+			}
+		})
+	}
+}
+
+func TestDecodeSysEx(t *testing.T) {
+	colors := [8]Color{Blue, Amber, {R: 1, G: 2, B: 3}, Off, Off, Off, Off, {R: 127, G: 127, B: 127}}
+	valid := SysEx(colors)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"empty", nil, true},
+		{"header only", SysExHeader, true},
+		{"truncated payload", valid[:len(valid)-7], true},
+		{"missing footer", valid[:len(valid)-1], true},
+		{"over-long", append(slices.Clone(valid), 0x00), true},
+		{"two messages", append(slices.Clone(valid), valid...), true},
+		{"wrong manufacturer", edited(valid, 1, 0x41), true},
+		{"wrong command", edited(valid, 6, 0x31), true},
+		{"no SysEx start", edited(valid, 0, 0x90), true},
+		{"wrong footer", edited(valid, len(valid)-1, 0x00), true},
+		{"non-zero high byte", edited(valid, len(SysExHeader), 0x01), true},
+		{"data byte over 127", edited(valid, len(SysExHeader)+1, 0x80), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeSysEx(tt.msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DecodeSysEx(% X) = %v, want an error", tt.msg, got)
+				}
+				if got != [8]Color{} {
+					t.Errorf("DecodeSysEx(% X) colors = %v, want all off on error", tt.msg, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeSysEx: %v", err)
+			}
+			if got != colors {
+				t.Errorf("DecodeSysEx = %v, want %v", got, colors)
+			}
+		})
+	}
+}
+
+// A copy of msg with byte i set to b
+func edited(msg []byte, i int, b byte) []byte {
+	msg = slices.Clone(msg)
+	msg[i] = b
+	return msg
+}
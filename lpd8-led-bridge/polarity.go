@@ -0,0 +1,111 @@
+package main
+
+// Live amber polarity (polarity_toggle_note): while the modifier pad is
+// held, pressing an amber flips whether it drives its blues opposite or
+// same instead of toggling it. The modifier pad then shows the polarity it
+// set, green for same and red for opposite. Flips override
+// amber_to_blues_mode, survive config reloads and are saved with -state.
+
+// Polarity modifier pad (0 = disabled), set from config
+var polarityToggleNote uint8
+
+var (
+	polarityHeld  bool                   // Modifier pad is down (guarded by stateMutex)
+	amberPolarity = make(map[uint8]bool) // Amber -> same, as flipped live (guarded by stateMutex)
+)
+
+// Modifier pad colors for the polarity it last set
+var (
+	polaritySameColor     = Color{G: 127}
+	polarityOppositeColor = Color{R: 127}
+)
+
+// Whether a note is the polarity modifier pad
+func isPolarityToggleNote(note uint8) bool {
+	return polarityToggleNote != 0 && note == polarityToggleNote
+}
+
+// Track the modifier pad going down or up
+func setPolarityHeld(held bool) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	polarityHeld = held
+}
+
+// Whether a press of note should flip its polarity rather than toggle it:
+// the modifier is held and note is an amber with blues
+func polarityFlipPress(note uint8) bool {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	_, isAmber := amberToBlues[note]
+	return polarityHeld && isAmber
+}
+
+// Flip an amber between opposite and same; if it's on, its blues follow
+// the new polarity straight away
+func flipAmberPolarity(amberNote uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	same := !amberSameMode[amberNote]
+	amberSameMode[amberNote] = same
+	amberPolarity[amberNote] = same
+	if same {
+		debugLog("Amber %d polarity: %s", amberNote, amberModeSame)
+	} else {
+		debugLog("Amber %d polarity: %s", amberNote, amberModeOpposite)
+	}
+
+	if padState[amberNote] {
+		for _, blueNote := range amberToBlues[amberNote] {
+			if !padMayChange(blueNote) {
+				continue
+			}
+			padSource[blueNote] = sourcePad
+			padState[blueNote] = same
+			if same {
+				padColors[noteToPayloadPos[blueNote]] = onColor(blueNote)
+			} else {
+				padColors[noteToPayloadPos[blueNote]] = colorOff
+			}
+		}
+	}
+
+	if pos, ok := noteToPayloadPos[polarityToggleNote]; ok {
+		padState[polarityToggleNote] = true
+		if same {
+			padColors[pos] = polaritySameColor
+		} else {
+			padColors[pos] = polarityOppositeColor
+		}
+	}
+
+	markStateDirty()
+	queueSend()
+}
+
+// Apply the live polarity flips on top of amber_to_blues_mode, dropping
+// flips for pads that are no longer ambers
+// Caller must hold stateMutex
+func applyAmberPolarityLocked() {
+	for amberNote, same := range amberPolarity {
+		if _, ok := amberToBlues[amberNote]; !ok {
+			delete(amberPolarity, amberNote)
+			continue
+		}
+		amberSameMode[amberNote] = same
+	}
+}
+
+// Restore polarity flips loaded from the state file
+func restoreAmberPolarity(polarity map[uint8]bool) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	for amberNote, same := range polarity {
+		amberPolarity[amberNote] = same
+	}
+	applyAmberPolarityLocked()
+}
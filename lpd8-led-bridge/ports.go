@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// Port lookup by name: a port with exactly that name wins, otherwise the
+// name must be part of exactly one port's name. Port names often carry a
+// client/port number that changes between reboots (e.g. "LPD8 mk2:LPD8 mk2
+// MIDI 1 24:0"), so "LPD8 mk2" keeps working; an ambiguous name is an error
+// rather than a guess. A plain number is the port's index as shown by -list.
+
+// No port matches the name
+var errNoPort = errors.New("no such port")
+
+func findOutPort(name string) (drivers.Out, error) {
+	return matchPort("output", name, midi.GetOutPorts())
+}
+
+func findInPort(name string) (drivers.In, error) {
+	return matchPort("input", name, midi.GetInPorts())
+}
+
+func matchPort[P fmt.Stringer](kind, name string, ports []P) (P, error) {
+	var none P
+	if i, err := strconv.Atoi(name); err == nil {
+		if i < 0 || i >= len(ports) {
+			return none, fmt.Errorf("MIDI %s port index %d out of range: there are %d %s ports (see -list)", kind, i, len(ports), kind)
+		}
+		log.Printf("Using MIDI %s port %q for index %d", kind, ports[i].String(), i)
+		return ports[i], nil
+	}
+
+	var matches []P
+	for _, port := range ports {
+		if port.String() == name {
+			return port, nil
+		}
+		if strings.Contains(port.String(), name) {
+			matches = append(matches, port)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return none, fmt.Errorf("%w: no MIDI %s port matches %q (see -list)", errNoPort, kind, name)
+	case 1:
+		log.Printf("Using MIDI %s port %q for %q", kind, matches[0].String(), name)
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, port := range matches {
+			names[i] = fmt.Sprintf("%q", port.String())
+		}
+		return none, fmt.Errorf("%q matches %d MIDI %s ports (%s), give more of the name", name, len(matches), kind, strings.Join(names, ", "))
+	}
+}
+
+// The name to find a port by again later (e.g. to reconnect): name as
+// given, unless it was an index, which can point elsewhere once ports come
+// and go - then the port's full name
+func portLookupName(name string, port fmt.Stringer) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		return port.String()
+	}
+	return name
+}
@@ -0,0 +1,55 @@
+package main
+
+import "log"
+
+// Pressure scene (aftertouch_scene): pressing hard - channel aftertouch
+// rising to aftertouch_scene_threshold - recalls a scene slot, and letting
+// up puts back the pads as they were just before. Pressure has to drop
+// pressureSceneHysteresis below the threshold to revert, so hovering
+// around it doesn't chatter between the two.
+
+const pressureSceneHysteresis = 16
+
+// Default aftertouch_scene_threshold
+const defaultPressureSceneThreshold = 100
+
+// Set from config
+var (
+	pressureScene          = -1 // Scene slot (0-3), -1 = off
+	pressureSceneThreshold uint8
+)
+
+// Pad states from before the pressure scene, nil while it isn't active
+// (guarded by stateMutex)
+var pressureSceneSaved map[uint8]bool
+
+// Recall or revert the pressure scene for a channel aftertouch value
+func handlePressureScene(pressure uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if pressureScene < 0 {
+		return
+	}
+	switch {
+	case pressureSceneSaved == nil && pressure >= pressureSceneThreshold:
+		scene := scenes[pressureScene]
+		if scene == nil {
+			debugLog("Aftertouch scene %d is empty", pressureScene+1)
+			return
+		}
+		pressureSceneSaved = make(map[uint8]bool, len(noteToPayloadPos))
+		for note := range noteToPayloadPos {
+			pressureSceneSaved[note] = padState[note]
+		}
+		applyPadStatesLocked(scene)
+		queueSend()
+		log.Printf("Scene %d recalled by aftertouch", pressureScene+1)
+
+	case pressureSceneSaved != nil && int(pressure) < int(pressureSceneThreshold)-pressureSceneHysteresis:
+		applyPadStatesLocked(pressureSceneSaved)
+		pressureSceneSaved = nil
+		queueSend()
+		log.Printf("Scene %d released, pads restored", pressureScene+1)
+	}
+}
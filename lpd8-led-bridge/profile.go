@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Config profiles (-config-dir DIR): every JSON/YAML file in DIR is a full
+// config, ordered by file name. An incoming Program Change N switches the
+// live mappings to profile N; the first profile is active at startup.
+
+type profile struct {
+	name string // File name without extension
+	path string
+}
+
+// Profiles from -config-dir (empty when not in use), set once at startup
+var profiles []profile
+
+var (
+	activeProfile int
+	profileMutex  sync.Mutex
+)
+
+// Profile switches from Program Changes, run in order outside the MIDI
+// handler, which holds the mappings read lock applyConfig waits on
+var (
+	profileQueue     = make(chan int, 16)
+	profileQueueOnce sync.Once
+)
+
+// Find and validate the profiles in dir, so a broken profile is reported at
+// startup rather than on the Program Change that selects it
+func loadProfiles(dir string) ([]profile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []profile
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && !isYAMLPath(entry.Name())) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, err := loadConfig(path); err != nil {
+			return nil, err
+		}
+		found = append(found, profile{strings.TrimSuffix(entry.Name(), ext), path})
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no .json, .yaml or .yml files in %s", dir)
+	}
+	return found, nil
+}
+
+// Profile names in program order, for logging
+func profileNames() string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = fmt.Sprintf("%d=%s", i, p.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// The config file a reload should read: the active profile if profiles are
+// in use, else path
+func activeConfigPath(path string) string {
+	if len(profiles) == 0 {
+		return path
+	}
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	return profiles[activeProfile].path
+}
+
+// Queue a switch to profile n from a MIDI handler
+func queueProfileSwitch(n int) {
+	profileQueueOnce.Do(func() {
+		go func() {
+			for n := range profileQueue {
+				switchProfile(n)
+			}
+		}()
+	})
+	select {
+	case profileQueue <- n:
+	default:
+		log.Printf("Profile switch busy, dropping Program Change %d", n)
+	}
+}
+
+// Switch to profile n (a Program Change number); numbers without a profile
+// are ignored, and a profile that fails to load keeps the current mappings
+func switchProfile(n int) {
+	if n >= len(profiles) {
+		debugLog("Program Change %d: no profile %d, ignoring", n, n)
+		return
+	}
+	p := profiles[n]
+
+	cfg, err := loadConfig(p.path)
+	if err != nil {
+		log.Printf("Profile %d (%s) failed to load, keeping current mappings: %v", n, p.name, err)
+		return
+	}
+
+	profileMutex.Lock()
+	activeProfile = n
+	profileMutex.Unlock()
+
+	applyConfig(cfg)
+	log.Printf("Profile %d active: %s", n, p.name)
+
+	if err := openProgramChangePorts(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
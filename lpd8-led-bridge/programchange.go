@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// Program Change pads: pressing a pad also sends a Program Change to another
+// MIDI output, e.g. to switch modes in DJ software
+
+type programChange struct {
+	port    string
+	program uint8
+	channel uint8 // 0-15
+}
+
+// Pad note -> Program Change to send, set from config
+var padToProgramChange = map[uint8]programChange{}
+
+// Open Program Change outputs by port name
+var (
+	pcPortsMutex sync.Mutex
+	pcPorts      = map[string]func(msg midi.Message) error{}
+)
+
+// Program Changes waiting to be sent; a full queue drops presses rather than
+// blocking MIDI handling
+var (
+	pcQueue     = make(chan programChange, 16)
+	pcQueueOnce sync.Once
+)
+
+// Open the output port for every configured Program Change, so a missing
+// port is reported at load rather than on the first press
+func openProgramChangePorts() error {
+	if dryRun {
+		return nil
+	}
+	for note, pc := range padToProgramChange {
+		if _, err := programChangePort(pc.port); err != nil {
+			return fmt.Errorf("pad_to_program_change[\"%d\"].port %q: %v", note, pc.port, err)
+		}
+	}
+	return nil
+}
+
+// Get the send function for a port, opening it on first use
+func programChangePort(name string) (func(msg midi.Message) error, error) {
+	pcPortsMutex.Lock()
+	defer pcPortsMutex.Unlock()
+
+	if send, ok := pcPorts[name]; ok {
+		return send, nil
+	}
+	out, err := findOutPort(name)
+	if err != nil {
+		return nil, err
+	}
+	send, err := midi.SendTo(out)
+	if err != nil {
+		return nil, err
+	}
+	pcPorts[name] = send
+	return send, nil
+}
+
+// Queue a pad's Program Change if it has one
+func sendProgramChange(note uint8) {
+	pc, ok := padToProgramChange[note]
+	if !ok {
+		return
+	}
+
+	pcQueueOnce.Do(func() { go runProgramChangeSender(pcQueue) })
+	select {
+	case pcQueue <- pc:
+	default:
+		log.Printf("Program Change output busy, dropping pad %d", note)
+	}
+}
+
+// Send queued Program Changes in order
+func runProgramChangeSender(queue chan programChange) {
+	for pc := range queue {
+		if dryRun {
+			fmt.Printf("Program Change %d ch=%d -> %s\n", pc.program, pc.channel+1, pc.port)
+			continue
+		}
+		send, err := programChangePort(pc.port)
+		if err != nil {
+			log.Printf("Program Change port %s: %v", pc.port, err)
+			continue
+		}
+		debugLog("Program Change %d ch=%d -> %s", pc.program, pc.channel+1, pc.port)
+		if err := send(midi.ProgramChange(pc.channel, pc.program)); err != nil {
+			log.Printf("Error sending Program Change to %s: %v", pc.port, err)
+		}
+	}
+}
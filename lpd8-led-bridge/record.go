@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// MIDI input recording (-record FILE) and replay (-replay FILE), for
+// reproducing a bug report without the devices that caused it. A recording
+// has one JSON object per line, one line per incoming message:
+//
+//	{"ms":1520,"input":"spy","port":"PLX-CRSS12","msg":"90 20 64","text":"NoteOn channel: 0 key: 32 velocity: 100"}
+//
+// ms is the time since recording started, input is the handler that got
+// the message ("lpd8" for pads/knobs, "spy" for the spy device) and msg is
+// the raw message in hex. text is for humans; replay uses port only to keep
+// several spy devices apart.
+
+// Handlers a recorded message can be fed to
+const (
+	inputLPD8 = "lpd8"
+	inputSpy  = "spy"
+)
+
+type recordedMsg struct {
+	Ms    int64  `json:"ms"`
+	Input string `json:"input"`
+	Port  string `json:"port,omitempty"`
+	Msg   string `json:"msg"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Writes incoming messages to a recording file
+type midiRecorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+	start time.Time
+	count int
+}
+
+func openMIDIRecorder(path string) (*midiRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &midiRecorder{f: f, enc: json.NewEncoder(f), start: time.Now()}, nil
+}
+
+// Wrap a handler so every message it gets is recorded first; a nil
+// recorder returns h unchanged
+func (r *midiRecorder) wrap(input, port string, h func(midi.Message, int32)) func(midi.Message, int32) {
+	if r == nil {
+		return h
+	}
+	return func(msg midi.Message, timestampms int32) {
+		r.record(input, port, msg)
+		h(msg, timestampms)
+	}
+}
+
+func (r *midiRecorder) record(input, port string, msg midi.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return // Closed
+	}
+	rec := recordedMsg{
+		Ms:    time.Since(r.start).Milliseconds(),
+		Input: input,
+		Port:  port,
+		Msg:   fmt.Sprintf("% X", []byte(msg)),
+		Text:  msg.String(),
+	}
+	if err := r.enc.Encode(rec); err != nil {
+		log.Printf("Recording failed, stopping: %v", err)
+		r.f.Close()
+		r.f = nil
+		return
+	}
+	r.count++
+}
+
+func (r *midiRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	log.Printf("Recorded %d MIDI messages", r.count)
+	return err
+}
+
+// Read a whole recording, so a malformed one fails before anything is sent
+func readRecording(path string) ([]recordedMsg, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []recordedMsg
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec recordedMsg
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if rec.Input != inputLPD8 && rec.Input != inputSpy {
+			return nil, fmt.Errorf("%s:%d: input %q must be %q or %q", path, line, rec.Input, inputLPD8, inputSpy)
+		}
+		if _, err := hex.DecodeString(strings.ReplaceAll(rec.Msg, " ", "")); err != nil {
+			return nil, fmt.Errorf("%s:%d: msg %q: %w", path, line, rec.Msg, err)
+		}
+		msgs = append(msgs, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Feed recorded messages to their handlers with the recorded timing, until
+// the recording ends or ctx is done
+func replayRecording(ctx context.Context, msgs []recordedMsg, handlerFor func(recordedMsg) func(midi.Message, int32)) {
+	start := time.Now()
+	for i, rec := range msgs {
+		wait := time.Until(start.Add(time.Duration(rec.Ms) * time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			log.Printf("Replay stopped after %d of %d messages", i, len(msgs))
+			return
+		}
+
+		data, _ := hex.DecodeString(strings.ReplaceAll(rec.Msg, " ", "")) // Checked by readRecording
+		debugLog("Replay %s: %v", rec.Input, midi.Message(data))
+		handlerFor(rec)(midi.Message(data), int32(rec.Ms))
+	}
+	log.Printf("Replay finished: %d messages", len(msgs))
+}
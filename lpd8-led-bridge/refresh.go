@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Watchdog for lossy USB links (-refresh): periodically re-send the full LED
+// state, so a SysEx the LPD8 dropped doesn't leave a pad wrong until it's
+// next pressed. The resend goes through the frame sender like any other
+// update, so it never races the handlers or the blinker.
+
+// Start re-sending the LED state every interval until ctx is done; the
+// returned function waits for it to stop
+func startRefresher(ctx context.Context, interval time.Duration) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			debugLog("Refresh: re-sending LED state")
+			resendFrame()
+		}
+	}()
+
+	return func() {
+		<-done
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"lpd8-led-bridge/pkg/lpd8"
+)
+
+// Release velocity feedback (use_release_velocity): a momentary pad
+// released with a Note Off velocity flashes at that brightness for
+// releaseFlash before going dark, instead of going dark at once. The pad
+// is off from the release on; only the light lingers.
+
+const releaseFlash = 150 * time.Millisecond
+
+var useReleaseVelocity bool // From config; guarded by stateMutex
+
+var releaseFlashes = map[uint8]int{} // Pad -> flash generation, so a re-press cancels it (guarded by stateMutex)
+
+// Turn a momentary pad off on release, flashing it at the release
+// velocity first if enabled
+func releaseMomentaryPad(note uint8, vel uint8) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pos, ok := noteToPayloadPos[note]
+	if !ok || !padState[note] {
+		return
+	}
+	padState[note] = false
+	if !useReleaseVelocity || vel == 0 {
+		padColors[pos] = colorOff
+		queueSend()
+		debugLog("Pad %d set -> OFF", note)
+		return
+	}
+
+	releaseFlashes[note]++
+	flash := releaseFlashes[note]
+	padColors[pos] = lpd8.ScaleColor(onColor(note), vel)
+	queueSend()
+	debugLog("Pad %d released at vel %d, flashing", note, vel)
+
+	time.AfterFunc(releaseFlash, func() {
+		stateMutex.Lock()
+		defer stateMutex.Unlock()
+		if releaseFlashes[note] != flash || padState[note] {
+			return // Pressed (or released) again since
+		}
+		padColors[pos] = colorOff
+		queueSend()
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "time"
+
+// Reload error flash (reload_error_flash): when a config reload is
+// rejected, every pad shows red for reloadFlash, drawn over the grid at
+// render time, so the pads come back exactly as they were.
+
+const reloadFlash = 500 * time.Millisecond
+
+var reloadFlashColor = Color{R: 127}
+
+var (
+	reloadErrorFlash bool // From config; guarded by stateMutex
+	reloadFlashing   bool // Flash showing (guarded by stateMutex)
+	reloadFlashes    int  // Flash generation, so an old flash doesn't end a new one (guarded by stateMutex)
+)
+
+// Flash every pad red to show a reload was rejected, if enabled
+func flashReloadError() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if !reloadErrorFlash {
+		return
+	}
+	reloadFlashing = true
+	reloadFlashes++
+	flash := reloadFlashes
+	queueSend()
+
+	time.AfterFunc(reloadFlash, func() {
+		stateMutex.Lock()
+		defer stateMutex.Unlock()
+		if reloadFlashes != flash {
+			return // Another rejected reload restarted the flash
+		}
+		reloadFlashing = false
+		queueSend()
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"lpd8-led-bridge/pkg/lpd8"
+)
+
+// Renderer encodes the 8 pad colors as the LED SysEx of one LPD8 variant.
+// buildSysEx renders through the selected renderer (-variant), so every
+// sender, test mode included, speaks the same protocol.
+type Renderer interface {
+	BuildSysEx(colors [8]Color) []byte
+}
+
+// LPD8 MK2: one message with an RGB triple per pad (see sysExHeader)
+type mk2Renderer struct{}
+
+func (mk2Renderer) BuildSysEx(colors [8]Color) []byte {
+	return lpd8.SysEx(colors)
+}
+
+// Device variants for -variant. Only the MK2 has pad LEDs that can be set
+// over MIDI: the original LPD8's LEDs just follow presses (and its toggle
+// mode), and Akai documents no message to set them, so there's no MK1
+// renderer and mk1 is refused with that reason.
+const (
+	variantMK1 = "mk1"
+	variantMK2 = "mk2"
+)
+
+// Renderer for the selected variant, set from -variant
+var renderer Renderer = mk2Renderer{}
+
+func rendererFor(variant string) (Renderer, error) {
+	switch variant {
+	case variantMK2:
+		return mk2Renderer{}, nil
+	case variantMK1:
+		return nil, fmt.Errorf("variant %q: the original LPD8's pad LEDs can't be set over MIDI, only %q is supported", variant, variantMK2)
+	default:
+		return nil, fmt.Errorf("unknown variant %q (want %q)", variant, variantMK2)
+	}
+}
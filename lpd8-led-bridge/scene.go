@@ -0,0 +1,148 @@
+package main
+
+import "log"
+
+// Scene memory: snapshot every pad's on/off state into one of four slots and
+// recall it later in a single update. Store/recall can be pads (taken out of
+// the normal mappings) or CCs; a recall pad is lit while its slot holds a
+// scene. Scenes live in memory only.
+
+const numScenes = 4
+
+// CC value at/above which a scene CC triggers (on the rise, like a button)
+const sceneCCThreshold = 64
+
+// Stored scenes (nil = empty slot), guarded by stateMutex
+var scenes [numScenes]map[uint8]bool
+
+// Scene controls -> slot, set from config
+var (
+	sceneStoreNotes  = map[uint8]int{}
+	sceneRecallNotes = map[uint8]int{}
+	sceneStoreCCs    = map[uint8]int{}
+	sceneRecallCCs   = map[uint8]int{}
+)
+
+// Scene CCs currently at/above the threshold, so holding one doesn't retrigger
+var sceneCCHigh = map[uint8]bool{}
+
+// Map each non-zero entry of a scene control list to its slot
+func sceneSlots(controls []int) map[uint8]int {
+	slots := make(map[uint8]int)
+	for slot, n := range controls {
+		if n != 0 && slot < numScenes {
+			slots[uint8(n)] = slot
+		}
+	}
+	return slots
+}
+
+func isSceneControl(note uint8) bool {
+	_, store := sceneStoreNotes[note]
+	_, recall := sceneRecallNotes[note]
+	return store || recall
+}
+
+// Handle a press of a scene store/recall pad
+func handleScenePress(note uint8) {
+	if slot, ok := sceneStoreNotes[note]; ok {
+		storeScene(slot)
+	} else if slot, ok := sceneRecallNotes[note]; ok {
+		recallScene(slot)
+	}
+}
+
+// Handle a CC; returns false if it isn't a scene CC
+func handleSceneCC(cc uint8, value uint8) bool {
+	storeSlot, store := sceneStoreCCs[cc]
+	recallSlot, recall := sceneRecallCCs[cc]
+	if !store && !recall {
+		return false
+	}
+
+	stateMutex.Lock()
+	high := value >= sceneCCThreshold
+	rising := high && !sceneCCHigh[cc]
+	sceneCCHigh[cc] = high
+	stateMutex.Unlock()
+
+	if !rising {
+		return true
+	}
+	if store {
+		storeScene(storeSlot)
+	} else {
+		recallScene(recallSlot)
+	}
+	return true
+}
+
+// Snapshot the current pad states into a slot
+func storeScene(slot int) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	scene := make(map[uint8]bool, len(noteToPayloadPos))
+	for note := range noteToPayloadPos {
+		if !reservedPads[note] {
+			scene[note] = padState[note]
+		}
+	}
+	scenes[slot] = scene
+	showSceneSlotsLocked()
+	queueSend()
+
+	log.Printf("Scene %d stored", slot+1)
+}
+
+// Apply a stored scene to every pad in one update
+func recallScene(slot int) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	scene := scenes[slot]
+	if scene == nil {
+		debugLog("Scene %d is empty", slot+1)
+		return
+	}
+	pushUndoLocked()
+	applyPadStatesLocked(scene)
+	queueSend()
+
+	log.Printf("Scene %d recalled", slot+1)
+}
+
+// Set the pads in states on or off, leaving reserved and unknown pads
+// Caller holds stateMutex and sends the update
+func applyPadStatesLocked(states map[uint8]bool) {
+	for note, on := range states {
+		pos, ok := noteToPayloadPos[note]
+		if !ok || reservedPads[note] {
+			continue
+		}
+		padSource[note] = sourcePad
+		padState[note] = on
+		if on {
+			padColors[pos] = onColor(note)
+		} else {
+			padColors[pos] = colorOff
+		}
+	}
+}
+
+// Light each recall pad whose slot holds a scene
+// Caller holds stateMutex and sends the update
+func showSceneSlotsLocked() {
+	for note, slot := range sceneRecallNotes {
+		pos, ok := noteToPayloadPos[note]
+		if !ok {
+			continue
+		}
+		padState[note] = scenes[slot] != nil
+		if padState[note] {
+			padColors[pos] = onColor(note)
+		} else {
+			padColors[pos] = colorOff
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Schema docs for config fields, keyed by JSON path (struct fields only,
+// map keys and array indexes don't add a segment). Min/Max apply to the
+// field itself, or to the items/values of arrays and maps.
+type schemaDoc struct {
+	Description string
+	Min, Max    *int
+}
+
+func intPtr(v int) *int { return &v }
+
+var noteRange = schemaDoc{Min: intPtr(0), Max: intPtr(127)}
+
+var schemaDocs = map[string]schemaDoc{
+	"":                              {Description: "LPD8 LED Bridge configuration"},
+	"lpd8":                          {Description: "LPD8 pad notes and channels (physical layout: top row 5-8, bottom row 1-4)"},
+	"lpd8.top_row":                  {"Notes for the top row pads 5-8 (blue LEDs)", noteRange.Min, noteRange.Max},
+	"lpd8.bottom_row":               {"Notes for the bottom row pads 1-4 (amber LEDs)", noteRange.Min, noteRange.Max},
+	"lpd8.knobs":                    {"CC numbers for knobs 1-8", noteRange.Min, noteRange.Max},
+	"lpd8.channel":                  {"MIDI channel for pads (0 = all channels)", intPtr(0), intPtr(16)},
+	"lpd8.knob_channel":             {"MIDI channel for knobs (0 = all channels)", intPtr(0), intPtr(16)},
+	"initial_state":                 {Description: "Whether each pad starts on, keyed by pad note (unlisted: top row on, bottom row off)"},
+	"lpd8.momentary":                {"Pads that light only while held (Note On -> on, Note Off -> off) instead of toggling", noteRange.Min, noteRange.Max},
+	"panic_note":                    {"Note that resets every pad to its initial state, from any input (0 = none)", noteRange.Min, noteRange.Max},
+	"panic_cc":                      {"CC that resets every pad to its initial state at values 64-127, from any input (0 = none)", noteRange.Min, noteRange.Max},
+	"undo_note":                     {"Note that undoes the last pad action, from any input (0 = none)", noteRange.Min, noteRange.Max},
+	"undo_cc":                       {"CC that undoes the last pad action at values 64-127, from any input (0 = none)", noteRange.Min, noteRange.Max},
+	"spy_remap":                     {"Spy device note -> LPD8 note, keyed by spy note number", noteRange.Min, noteRange.Max},
+	"spy_remap_by_port":             {"Per-spy spy_remap, keyed by -spy port name; used instead of spy_remap for that port", noteRange.Min, noteRange.Max},
+	"spy_cc_remap":                  {"Spy device CC -> pad note that follows it (on at/above spy_cc_threshold)", noteRange.Min, noteRange.Max},
+	"spy_cc_threshold":              {"Spy CC value at/above which its pad is on (0 = default 64)", intPtr(0), intPtr(127)},
+	"amber_to_blues":                {"Amber note -> list of blue notes it controls (blues go to the opposite state of the amber)", noteRange.Min, noteRange.Max},
+	"amber_to_color_cycle":          {Description: "Amber note -> colors each press steps the blue above it through, wrapping around; off (0,0,0) turns the blue off (values above 127 are clamped)"},
+	"amber_to_color_cycle.r":        {"Red (0-127)", intPtr(0), intPtr(127)},
+	"amber_to_color_cycle.g":        {"Green (0-127)", intPtr(0), intPtr(127)},
+	"amber_to_color_cycle.b":        {"Blue (0-127)", intPtr(0), intPtr(127)},
+	"amber_to_blues_mode":           {Description: `Amber note -> how it drives its blues: "opposite" (default, blues off while the amber is on) or "same" (blues on with it)`},
+	"knob_to_blue":                  {"Knob CC -> blue note whose LED follows the knob", noteRange.Min, noteRange.Max},
+	"knob_to_toggle":                {"Knob CC -> pad note pressed when the CC goes to 64 or above and released below 64, like a pad", noteRange.Min, noteRange.Max},
+	"knob_to_channel":               {Description: "Knob CC -> one color channel of a pad's on color, set from the knob value (0-127)"},
+	"knob_to_channel.note":          {"Pad note whose color the knob sets", noteRange.Min, noteRange.Max},
+	"knob_to_channel.channel":       {Description: `Color channel: "r", "g" or "b"`},
+	"ignore_note_repeat":            {Description: "Treat repeated NoteOns for a held pad as one press until its NoteOff"},
+	"knob_vs_pad_priority":          {Description: `Who wins for blues driven by both a knob and pads: "" (last change), "knob" or "pad"`},
+	"knob_comet":                    {Description: "Knob CC -> row sweep with a fading tail"},
+	"knob_comet.row":                {Description: `Row to sweep: "top" or "bottom"`},
+	"knob_comet.tail":               {"Number of fading pads behind the head", intPtr(0), intPtr(3)},
+	"clock_indicator_note":          {"Pad that pulses on each quarter note of incoming MIDI clock and stays dark without it (0 = off)", noteRange.Min, noteRange.Max},
+	"palette_cycle_note":            {"Pad that steps through palettes, then back to the normal colors (0 = off)", noteRange.Min, noteRange.Max},
+	"palettes":                      {Description: "Palettes for palette_cycle_note: on colors for pads 1-8, bottom row first (values above 127 are clamped)"},
+	"palettes.r":                    {"Red (0-127)", intPtr(0), intPtr(127)},
+	"palettes.g":                    {"Green (0-127)", intPtr(0), intPtr(127)},
+	"palettes.b":                    {"Blue (0-127)", intPtr(0), intPtr(127)},
+	"polarity_toggle_note":          {"Modifier pad: pressing an amber while it's held flips it between opposite and same (0 = off)", noteRange.Min, noteRange.Max},
+	"tap_tempo_note":                {"Pad tapped in time to set a tempo for the clock indicator and -clock-sync blinking without MIDI clock (0 = off)", noteRange.Min, noteRange.Max},
+	"cc_feedback":                   {"Host feedback CC -> pad note whose LED is on while the CC is at/above the threshold", noteRange.Min, noteRange.Max},
+	"cc_feedback_channel":           {"MIDI channel for feedback CCs (0 = all channels)", intPtr(0), intPtr(16)},
+	"cc_feedback_threshold":         {"CC value at/above which a feedback pad is on (0 = default 64)", intPtr(0), intPtr(127)},
+	"spy_velocity_brightness":       {Description: "Scale the on-color of spy-pressed pads by the press velocity"},
+	"pad_cooldowns":                 {"Pad note -> ms during which further presses of that pad are ignored after one registers", intPtr(0), intPtr(60000)},
+	"pad_colors":                    {Description: "Pad note -> on color, overriding the row default (values above 127 are clamped)"},
+	"pad_colors.r":                  {"Red (0-127)", intPtr(0), intPtr(127)},
+	"pad_colors.g":                  {"Green (0-127)", intPtr(0), intPtr(127)},
+	"split_pads":                    {Description: "Pad note -> two colors the pad swaps between rapidly while on, reading as a blend (values above 127 are clamped)"},
+	"split_pads.r":                  {"Red (0-127)", intPtr(0), intPtr(127)},
+	"split_pads.g":                  {"Green (0-127)", intPtr(0), intPtr(127)},
+	"split_pads.b":                  {"Blue (0-127)", intPtr(0), intPtr(127)},
+	"channel_colors":                {Description: "MIDI channel (1-16) -> on color for pads pressed from that channel, after pad_colors (values above 127 are clamped)"},
+	"channel_colors.r":              {"Red (0-127)", intPtr(0), intPtr(127)},
+	"channel_colors.g":              {"Green (0-127)", intPtr(0), intPtr(127)},
+	"channel_colors.b":              {"Blue (0-127)", intPtr(0), intPtr(127)},
+	"pad_colors.b":                  {"Blue (0-127)", intPtr(0), intPtr(127)},
+	"knob_fade_time":                {"Knob CC -> longest fade in ms (0 = 1000); the knob sets fade_ms live from 0 up to it", intPtr(0), intPtr(10000)},
+	"knob_color_temp":               {"Knob CC -> color temperature strength (max red/blue boost, 0 = 40); knob center is neutral", intPtr(0), intPtr(127)},
+	"brightness":                    {"Master brightness scaling every LED (0 = 127, full)", intPtr(0), intPtr(127)},
+	"brightness_cc":                 {"Knob CC that sets the master brightness live (0 = none)", intPtr(0), intPtr(127)},
+	"knob_gamma":                    {Description: "Gamma correction for knob brightness (knob_to_blue and brightness_cc), 0.1-5 (0 = 2.2)"},
+	"reload_error_flash":            {Description: "Flash every pad red briefly when a config reload is rejected"},
+	"use_release_velocity":          {Description: "Flash momentary pads at their Note Off velocity briefly before they go dark"},
+	"linear_knob_brightness":        {Description: "Scale knob brightness linearly instead of gamma correcting it"},
+	"knob_in_min":                   {Description: "Knob value that gives knob_out_min brightness (0-127, default 0)"},
+	"knob_in_max":                   {Description: "Knob value that gives knob_out_max brightness (1-127, 0 = 64)"},
+	"knob_out_min":                  {Description: "knob_to_blue brightness at knob_in_min, before gamma correction (0-127, default 0)"},
+	"knob_out_max":                  {Description: "knob_to_blue brightness at knob_in_max, before gamma correction (1-127, 0 = 127)"},
+	"record_note":                   {"Hold to record a sequence of pad presses (a second press also stops); 0 = off", noteRange.Min, noteRange.Max},
+	"play_note":                     {"Press to start/stop looping the recorded presses; 0 = off", noteRange.Min, noteRange.Max},
+	"key_map":                       {Description: `Pad note -> key combination pressed when the pad turns on, e.g. "ctrl+shift+a"`},
+	"pad_to_program_change":         {Description: "Pad note -> Program Change sent to another MIDI output each time the pad is pressed"},
+	"pad_to_program_change.port":    {Description: "MIDI output port name (must exist at load)"},
+	"pad_to_program_change.program": {"Program number", intPtr(0), intPtr(127)},
+	"pad_to_program_change.channel": {"MIDI channel", intPtr(1), intPtr(16)},
+	"output_interval_ms":            {"Minimum ms between LED updates; changes in between are combined (0 = 10)", intPtr(0), intPtr(1000)},
+	"auto_off_ms":                   {"Turn a pad pressed on back off after this many ms unless pressed again; ambers take their blues with them (0 = never)", intPtr(0), intPtr(86400000)},
+	"fade_ms":                       {"Fade each pad's LED to its new color over this many ms (0 = instant)", intPtr(0), intPtr(10000)},
+	"save_pre_blackout_state":       {Description: "With -state, save the pads as they were before a tray blackout while the grid is still dark from it"},
+	"aftertouch_scene":              {"Scene slot recalled while channel aftertouch is at or above aftertouch_scene_threshold; easing off restores the pads (0 = off)", intPtr(0), intPtr(4)},
+	"aftertouch_scene_threshold":    {"Channel aftertouch that recalls aftertouch_scene (0 = 100)", intPtr(0), intPtr(127)},
+	"broadcast_ms":                  {"Minimum ms between WebSocket state messages to each client, always ending on the latest state (0 = one per frame)", intPtr(0), intPtr(10000)},
+	"auto_save_sec":                 {"With -state, save pad states at most this often in seconds while they change, and on exit (0 = on every change)", intPtr(0), intPtr(86400)},
+	"blink":                         {"Pads that blink while on instead of holding a steady color", noteRange.Min, noteRange.Max},
+	"blink_rates":                   {"Pads that blink at their own rate: pad note -> full blink period in ms (lit half, dark half)", intPtr(1), intPtr(20000)},
+	"blink_ms":                      {"Blink half-period in ms: time on, then time off (0 = 500)", intPtr(0), intPtr(10000)},
+	"aftertouch":                    {Description: "Brighten a held pad's LED with aftertouch pressure (polyphonic, or channel aftertouch for the last pad pressed); pad states don't change"},
+	"velocity_sensitive":            {Description: "Scale the on-color of every pressed pad (LPD8 and spy) by the press velocity"},
+	"groups":                        {"Exclusive pad groups: turning one pad on turns the others in its group off (a pad can be in one group)", noteRange.Min, noteRange.Max},
+	"knob_off_threshold":            {"knob_to_blue value below which a lit blue turns off (0 = 2)", intPtr(0), intPtr(127)},
+	"knob_on_threshold":             {"knob_to_blue value at/above which an unlit blue turns on (0 = 3); must be >= knob_off_threshold", intPtr(0), intPtr(127)},
+	"knob_smoothing":                {Description: "Smoothing factor for knob_to_blue knobs, at least 0 and below 1 (0 = off): the LED eases toward each new knob value, higher is smoother but slower"},
+	"knob_momentary":                {"knob_to_blue CCs that light their pad only while turned up, without toggling it", noteRange.Min, noteRange.Max},
+	"knob_mode":                     {Description: `knob_to_blue CC -> what the knob does to its lit pad: "brightness" (default) or "hue" (color wheel)`},
+	"scene_store":                   {"Pads that store the current pad layout in scenes 1-4 (0 = none)", noteRange.Min, noteRange.Max},
+	"scene_recall":                  {"Pads that recall scenes 1-4 (0 = none); lit while their scene is stored", noteRange.Min, noteRange.Max},
+	"scene_store_cc":                {"CCs that store scenes 1-4 when rising to 64 or above (0 = none)", noteRange.Min, noteRange.Max},
+	"scene_recall_cc":               {"CCs that recall scenes 1-4 when rising to 64 or above (0 = none)", noteRange.Min, noteRange.Max},
+	"long_press":                    {Description: `Pad note -> action when held for long_press_ms instead of tapped: "all-off", "store-scene-N" or "recall-scene-N" (N = 1-4)`},
+	"long_press_ms":                 {"Hold time in ms that makes a press a long press (0 = 500)", intPtr(0), intPtr(10000)},
+	"double_tap":                    {Description: `Pad note -> action when pressed twice within double_tap_ms instead of toggling: "solo" (this pad on, the rest of its row off), "all-off", "store-scene-N" or "recall-scene-N" (N = 1-4)`},
+	"double_tap_ms":                 {"Time in ms within which a second press is a double tap (0 = 300)", intPtr(0), intPtr(2000)},
+	"loop_max_presses":              {"Presses of one pad within loop_window_ms above which it is treated as a feedback loop and ignored (0 = 20)", intPtr(0), intPtr(1000)},
+	"loop_window_ms":                {"Feedback loop detection window in ms; an ignored pad is handled again once quiet this long (0 = 1000)", intPtr(0), intPtr(60000)},
+	"press_merge_ms":                {"Presses of the same pad from different sources within this many ms count as one (0 = off)", intPtr(0), nil},
+}
+
+// Enumerated string values, keyed by JSON path
+var schemaEnums = map[string][]string{
+	"knob_vs_pad_priority":    {"", sourceKnob, sourcePad},
+	"knob_comet.row":          {"top", "bottom"},
+	"knob_mode":               {"", knobModeBrightness, knobModeHue},
+	"amber_to_blues_mode":     {"", amberModeOpposite, amberModeSame},
+	"knob_to_channel.channel": {"r", "g", "b"},
+}
+
+// Maps of note/CC maps keyed by name rather than note/CC number
+var schemaNameKeys = map[string]bool{
+	"spy_remap_by_port": true,
+}
+
+// Generate a JSON Schema (draft 2020-12) for the Config struct
+func configSchema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "lpd8-led-bridge config"
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func schemaFor(t reflect.Type, path string) map[string]any {
+	doc := schemaDocs[path]
+	s := map[string]any{}
+	if doc.Description != "" {
+		s["description"] = doc.Description
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s["type"] = "object"
+		props := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			props[name] = schemaFor(f.Type, strings.TrimPrefix(path+"."+name, "."))
+		}
+		s["properties"] = props
+		s["additionalProperties"] = false
+	case reflect.Array, reflect.Slice:
+		s["type"] = "array"
+		s["items"] = itemSchema(t.Elem(), path)
+		if t.Kind() == reflect.Array {
+			s["minItems"] = t.Len()
+			s["maxItems"] = t.Len()
+		}
+	case reflect.Map:
+		// Map keys are note/CC numbers as strings, except the outer keys of
+		// maps of maps keyed by name
+		s["type"] = "object"
+		if !schemaNameKeys[path] || t.Elem().Kind() != reflect.Map {
+			s["propertyNames"] = map[string]any{"pattern": "^[0-9]+$"}
+		}
+		s["additionalProperties"] = itemSchema(t.Elem(), path)
+	default:
+		for k, v := range scalarSchema(t, path) {
+			s[k] = v
+		}
+	}
+	return s
+}
+
+// Schema for array items or map values, carrying the parent's range
+func itemSchema(t reflect.Type, path string) map[string]any {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+		s := schemaFor(t, path)
+		delete(s, "description")
+		return s
+	}
+	return scalarSchema(t, path)
+}
+
+func scalarSchema(t reflect.Type, path string) map[string]any {
+	doc := schemaDocs[path]
+	s := map[string]any{}
+	switch t.Kind() {
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.String:
+		s["type"] = "string"
+		if enum, ok := schemaEnums[path]; ok {
+			s["enum"] = enum
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s["type"] = "integer"
+		if doc.Min != nil {
+			s["minimum"] = *doc.Min
+		}
+		if doc.Max != nil {
+			s["maximum"] = *doc.Max
+		}
+	case reflect.Float32, reflect.Float64:
+		s["type"] = "number"
+	}
+	return s
+}
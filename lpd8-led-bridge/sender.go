@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+
+	"lpd8-led-bridge/pkg/lpd8"
+)
+
+// Sender takes complete LED SysEx messages. The LPD8 outputs, the serial and
+// LED-tap mirrors and dry-run printing are all Senders, chained in main and
+// handed to the frame sender, so LED logic can be driven against any Sender
+// (e.g. one that records messages) without MIDI.
+type Sender = lpd8.Sender
+
+// SenderFunc adapts a function to a Sender
+type SenderFunc = lpd8.SenderFunc
+
+// frameQueue is the Sender the pad handlers get in the running bridge: it
+// hands the update to the frame sender, which sends the current grid as
+// rendered (blink, fades, brightness), so the message itself is dropped
+type frameQueue struct{}
+
+func (frameQueue) Send([]byte) error {
+	queueSend()
+	return nil
+}
+
+// Sender for pad updates from handlers (a recording Sender in tests)
+var ledOut Sender = frameQueue{}
+
+// Send the grid after a pad handler changed it
+// Caller must hold stateMutex
+func sendPadsLocked(out Sender) {
+	if err := out.Send(buildSysEx(padColors)); err != nil {
+		log.Printf("Error sending SysEx: %v", err)
+	}
+}
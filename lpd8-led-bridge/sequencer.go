@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Press sequencer: record a sequence of pad presses with their timing while
+// the record pad is held, then loop it back through the normal press handling
+
+// Source name for replayed presses (never recorded or merged with live ones)
+const sequencerSource = "SEQ"
+
+// Record/play pads (0 = disabled), set from config
+var recordNote, playNote uint8
+
+type seqEvent struct {
+	note  uint8
+	vel   uint8
+	delay time.Duration // Time since the previous event (or record start)
+}
+
+type sequencer struct {
+	mu        sync.Mutex
+	recording bool
+	events    []seqEvent
+	lastAt    time.Time
+	stop      chan struct{} // Non-nil while playing
+	press     func(source string, note uint8, vel uint8)
+}
+
+var seq = &sequencer{}
+
+// Start recording, discarding any previous sequence (stops playback)
+func (s *sequencer) startRecording() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recording {
+		return
+	}
+	s.stopPlaybackLocked()
+	s.recording = true
+	s.events = nil
+	s.lastAt = time.Now()
+	log.Println("Sequencer: recording")
+	setPad(ledOut, recordNote, true)
+}
+
+func (s *sequencer) stopRecording() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recording {
+		return
+	}
+	s.recording = false
+	log.Printf("Sequencer: recorded %d presses", len(s.events))
+	setPad(ledOut, recordNote, false)
+}
+
+// Record a live press if recording
+func (s *sequencer) record(source string, note uint8, vel uint8) {
+	if source == sequencerSource {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recording {
+		return
+	}
+	now := time.Now()
+	s.events = append(s.events, seqEvent{note, vel, now.Sub(s.lastAt)})
+	s.lastAt = now
+}
+
+// Toggle looped playback of the recorded sequence
+func (s *sequencer) togglePlayback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		s.stopPlaybackLocked()
+		return
+	}
+	if s.recording || len(s.events) == 0 {
+		debugLog("Sequencer: nothing to play")
+		return
+	}
+
+	events := append([]seqEvent(nil), s.events...)
+	stop := make(chan struct{})
+	s.stop = stop
+	log.Printf("Sequencer: playing %d presses", len(events))
+	setPad(ledOut, playNote, true)
+	go s.play(events, stop)
+}
+
+// Stop playback (caller holds mu)
+func (s *sequencer) stopPlaybackLocked() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stop = nil
+	log.Println("Sequencer: stopped")
+	setPad(ledOut, playNote, false)
+}
+
+// Loop the sequence through the press handler until stopped
+func (s *sequencer) play(events []seqEvent, stop chan struct{}) {
+	for {
+		for _, ev := range events {
+			select {
+			case <-stop:
+				return
+			case <-time.After(ev.delay):
+			}
+			mappingsMutex.RLock()
+			s.press(sequencerSource, ev.note, ev.vel)
+			mappingsMutex.RUnlock()
+		}
+		// Guard against a zero-length loop spinning
+		select {
+		case <-stop:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Whether a note is the record or play pad
+func (s *sequencer) isControl(note uint8) bool {
+	return (recordNote != 0 && note == recordNote) || (playNote != 0 && note == playNote)
+}
+
+// Handle a press of the record or play pad
+func (s *sequencer) handlePress(note uint8) {
+	switch note {
+	case recordNote:
+		s.mu.Lock()
+		recording := s.recording
+		s.mu.Unlock()
+		// Devices without NoteOff stop recording on a second press
+		if recording {
+			s.stopRecording()
+		} else {
+			s.startRecording()
+		}
+	case playNote:
+		s.togglePlayback()
+	}
+}
+
+// Handle a release; releasing the record pad stops recording
+func (s *sequencer) handleRelease(note uint8) {
+	if recordNote != 0 && note == recordNote {
+		s.stopRecording()
+	}
+}
+
+func (s *sequencer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recording = false
+	s.stopPlaybackLocked()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Serial state output for external displays (e.g. an Arduino LED mirror)
+//
+// Every time the grid changes one line is written:
+//
+//	LPD8 RRGGBB RRGGBB RRGGBB RRGGBB RRGGBB RRGGBB RRGGBB RRGGBB\n
+//
+// Each RRGGBB is the pad color in hex (channels 00-7F), in SysEx payload
+// order: positions 0-3 are the bottom row (pads 1-4), 4-7 the top row (pads 5-8).
+// This format is stable - new fields will only ever be added as new line types.
+
+// How long to wait before retrying a serial port that failed to open or write
+const serialRetryInterval = 5 * time.Second
+
+// Lines queued for the writer; when it falls behind (a stalled or
+// unplugged port) the oldest queued line is dropped, so the display always
+// ends up on the latest state
+const serialQueueSize = 8
+
+// How long Close waits for queued lines to be written
+const serialCloseTimeout = time.Second
+
+// Serial output: the frame sender only queues lines, a writer goroutine
+// owns the port, so a slow or missing port never holds up LED updates
+type serialOutput struct {
+	name  string
+	baud  int
+	lines chan string
+	quit  chan struct{}
+	done  chan struct{}
+
+	// Only used by the writer goroutine once started
+	port      serial.Port
+	lastTried time.Time
+}
+
+func newSerialOutput(name string, baud int) *serialOutput {
+	s := &serialOutput{
+		name:  name,
+		baud:  baud,
+		lines: make(chan string, serialQueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Open the port if it isn't already, at most every serialRetryInterval
+func (s *serialOutput) open() {
+	if s.port != nil || time.Since(s.lastTried) < serialRetryInterval {
+		return
+	}
+	s.lastTried = time.Now()
+
+	port, err := serial.Open(s.name, &serial.Mode{BaudRate: s.baud})
+	if err != nil {
+		log.Printf("Serial port %s unavailable: %v", s.name, err)
+		return
+	}
+	s.port = port
+	log.Printf("Serial output: %s (%d baud)", s.name, s.baud)
+}
+
+// Write queued lines until Close, reopening the port if it went away
+func (s *serialOutput) run() {
+	defer close(s.done)
+	defer func() {
+		if s.port != nil {
+			s.port.Close()
+		}
+	}()
+
+	s.open()
+	for {
+		select {
+		case line := <-s.lines:
+			s.write(line)
+		case <-s.quit:
+			// Flush what's queued (e.g. the final state) before closing
+			for {
+				select {
+				case line := <-s.lines:
+					s.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *serialOutput) write(line string) {
+	s.open()
+	if s.port == nil {
+		return
+	}
+	if _, err := s.port.Write([]byte(line)); err != nil {
+		log.Printf("Serial write to %s failed: %v", s.name, err)
+		s.port.Close()
+		s.port = nil
+	}
+}
+
+// Queue the grid state line; never blocks
+func (s *serialOutput) writeState(colors [8]Color) {
+	line := formatStateLine(colors)
+	for {
+		select {
+		case s.lines <- line:
+			return
+		default:
+		}
+		select {
+		case <-s.lines:
+			debugLog("Serial output %s behind, dropping a state line", s.name)
+		default:
+		}
+	}
+}
+
+// Stop the writer, waiting briefly for queued lines, and close the port
+func (s *serialOutput) Close() {
+	close(s.quit)
+	select {
+	case <-s.done:
+	case <-time.After(serialCloseTimeout):
+		log.Printf("Serial port %s not responding, closing without flushing", s.name)
+	}
+}
+
+// Format the grid as a single state line (see format above)
+func formatStateLine(colors [8]Color) string {
+	var b strings.Builder
+	b.WriteString("LPD8")
+	for _, c := range colors {
+		fmt.Fprintf(&b, " %02X%02X%02X", c.R, c.G, c.B)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
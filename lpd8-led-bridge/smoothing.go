@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Knob smoothing (knob_smoothing): jittery pots send a stream of +-1 values,
+// so instead of applying each raw value, a KnobToBlue knob's applied value
+// eases toward the latest raw one with exponential smoothing. A single
+// goroutine steps every moving knob and exits once they have all settled.
+
+// Time between smoothing steps
+const knobSmoothStep = 10 * time.Millisecond
+
+type smoothedKnob struct {
+	value   float64 // Smoothed value
+	target  float64 // Latest raw value
+	factor  float64 // Fraction of value kept each step
+	applied uint8   // Last value passed to applyBlueKnob
+	out     Sender  // Where applyBlueKnob sends the update
+}
+
+var (
+	smoothKnobs   = make(map[uint8]*smoothedKnob)
+	smoothRunning bool
+	smoothMutex   sync.Mutex
+)
+
+// Feed a raw knob value into the smoothing filter; a knob's first value is
+// applied as is, since there's nothing to ease from
+func smoothKnob(out Sender, cc uint8, value uint8, factor float64) {
+	smoothMutex.Lock()
+	k, ok := smoothKnobs[cc]
+	if !ok {
+		smoothKnobs[cc] = &smoothedKnob{float64(value), float64(value), factor, value, out}
+		smoothMutex.Unlock()
+		applyBlueKnob(out, cc, value)
+		return
+	}
+	k.target = float64(value)
+	k.factor = factor
+	k.out = out
+	start := !smoothRunning
+	smoothRunning = true
+	smoothMutex.Unlock()
+
+	if start {
+		go easeKnobs()
+	}
+}
+
+// Step every knob toward its target until none is moving
+func easeKnobs() {
+	ticker := time.NewTicker(knobSmoothStep)
+	defer ticker.Stop()
+
+	type step struct {
+		out       Sender
+		cc, value uint8
+	}
+	for range ticker.C {
+		var steps []step
+		moving := false
+
+		smoothMutex.Lock()
+		for cc, k := range smoothKnobs {
+			if k.value == k.target {
+				continue
+			}
+			k.value = k.value*k.factor + k.target*(1-k.factor)
+			if math.Abs(k.target-k.value) < 0.5 {
+				k.value = k.target
+			} else {
+				moving = true
+			}
+			if v := uint8(math.Round(k.value)); v != k.applied {
+				k.applied = v
+				steps = append(steps, step{k.out, cc, v})
+			}
+		}
+		if !moving {
+			smoothRunning = false
+		}
+		smoothMutex.Unlock()
+
+		// Apply outside smoothMutex, applyBlueKnob takes stateMutex
+		mappingsMutex.RLock()
+		for _, s := range steps {
+			applyBlueKnob(s.out, s.cc, s.value)
+		}
+		mappingsMutex.RUnlock()
+		if !moving {
+			return
+		}
+	}
+}
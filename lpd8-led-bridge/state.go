@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Pad state persistence (-state FILE): which pads were on is saved when
+// they change (at most every auto_save_sec if set) and on a clean
+// shutdown, and restored at the next startup
+//
+//	{"pad_state": {"36": false, "40": true, ...}, "amber_polarity": {"36": "same"}}
+//
+// amber_polarity holds ambers flipped with polarity_toggle_note.
+
+type savedState struct {
+	PadState      map[string]bool   `json:"pad_state"`
+	AmberPolarity map[string]string `json:"amber_polarity,omitempty"`
+}
+
+// Load saved pad states and amber polarity flips (amber -> same); a
+// missing or corrupt file gives nil so the caller falls back to the
+// default initial state
+func loadState(path string) (map[uint8]bool, map[uint8]bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		debugLog("No saved state loaded from %s: %v", path, err)
+		return nil, nil
+	}
+
+	var saved savedState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		debugLog("Ignoring corrupt state file %s: %v", path, err)
+		return nil, nil
+	}
+
+	polarity := make(map[uint8]bool, len(saved.AmberPolarity))
+	for key, mode := range saved.AmberPolarity {
+		note, err := strconv.Atoi(key)
+		if err != nil || note < 0 || note > 127 {
+			continue
+		}
+		polarity[uint8(note)] = mode == amberModeSame
+	}
+
+	states := make(map[uint8]bool, len(saved.PadState))
+	for key, on := range saved.PadState {
+		note, err := strconv.Atoi(key)
+		if err != nil || note < 0 || note > 127 {
+			continue
+		}
+		states[uint8(note)] = on
+	}
+	return states, polarity
+}
+
+// Save the current pad states, replacing the file atomically; while the
+// grid is still dark from a blackout (save_pre_blackout_state), the states
+// from before it are saved instead
+func saveState(path string) error {
+	stateMutex.Lock()
+	states := padState
+	if preBlackoutState != nil {
+		for note := range noteToPayloadPos {
+			if padState[note] {
+				preBlackoutState = nil // Pads were turned on since, so they win
+				break
+			}
+		}
+		if preBlackoutState != nil {
+			states = preBlackoutState
+		}
+	}
+	saved := savedState{PadState: make(map[string]bool, len(noteToPayloadPos))}
+	for note := range noteToPayloadPos {
+		saved.PadState[strconv.Itoa(int(note))] = states[note]
+	}
+	if len(amberPolarity) > 0 {
+		saved.AmberPolarity = make(map[string]string, len(amberPolarity))
+		for note, same := range amberPolarity {
+			mode := amberModeOpposite
+			if same {
+				mode = amberModeSame
+			}
+			saved.AmberPolarity[strconv.Itoa(int(note))] = mode
+		}
+	}
+	stateMutex.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Minimum time between saves, set from config (0 = save on every change)
+var autoSaveInterval time.Duration
+
+var (
+	savePreBlackout  bool           // From config; guarded by stateMutex
+	preBlackoutState map[uint8]bool // Pad states before the current blackout, nil if none (guarded by stateMutex)
+)
+
+var (
+	stateSaving bool                   // -state is set; guarded by stateMutex
+	stateSeen   = make(map[uint8]bool) // Pad states as of the last change noticed (guarded by stateMutex)
+	stateDirty  = make(chan struct{}, 1)
+)
+
+// Note whether the pad states changed since the last call, marking the
+// state dirty for the saver if so; pads owned by a feature aren't saved,
+// so they're ignored. Called for every frame.
+// Caller must hold stateMutex
+func noticeStateLocked() {
+	if !stateSaving {
+		return
+	}
+	changed := false
+	for note := range noteToPayloadPos {
+		if reservedPads[note] {
+			continue
+		}
+		if on, ok := stateSeen[note]; !ok || on != padState[note] {
+			stateSeen[note] = padState[note]
+			changed = true
+		}
+	}
+	if changed {
+		markStateDirty()
+	}
+}
+
+// Mark the saved state out of date; never blocks
+func markStateDirty() {
+	select {
+	case stateDirty <- struct{}{}:
+	default:
+	}
+}
+
+// Start saving the pad state to path whenever it changes, at most once
+// per autoSaveInterval, until ctx is done; the returned function waits for
+// it to stop (the shutdown save comes after)
+func startStateSaver(ctx context.Context, path string) func() {
+	stateMutex.Lock()
+	stateSaving = true
+	for note := range noteToPayloadPos {
+		stateSeen[note] = padState[note] // The state just restored needs no save
+	}
+	stateMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stateDirty:
+			case <-ctx.Done():
+				return
+			}
+			if err := saveState(path); err != nil {
+				log.Printf("Failed to save state: %v", err)
+			} else {
+				debugLog("Saved pad state to: %s", path)
+			}
+
+			// Changes during the wait go out in the next save
+			stateMutex.Lock()
+			interval := autoSaveInterval
+			stateMutex.Unlock()
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		<-done
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Tap tempo (tap_tempo_note): tapping a pad sets a tempo that pulses the
+// clock indicator and, with -clock-sync, drives the beat-synced blink the
+// same way incoming MIDI clock does. The tempo is the average of the last
+// few tap intervals; a pause of tapResetGap starts a new set of taps, and
+// the last tempo keeps running until new taps replace it. MIDI clock takes
+// over whenever it's being received.
+
+const (
+	tapResetGap = 2 * time.Second        // Gap that starts a new set of taps
+	tapMaxTaps  = 5                      // Taps averaged (4 intervals)
+	tapFlash    = 100 * time.Millisecond // How long the pad lights per tap
+)
+
+// Tap tempo pad (0 = disabled), set from config
+var tapTempoNote uint8
+
+var (
+	tapMutex   sync.Mutex
+	tapTimes   []time.Time   // Recent taps, oldest first
+	tapPeriod  time.Duration // Beat length (0 = no tempo tapped yet)
+	tapStart   time.Time     // A beat (the last tap that set the tempo)
+	tapChanged = make(chan struct{}, 1)
+	tapFlashes int // Flash generation, so an old flash doesn't end a new one (guarded by stateMutex)
+)
+
+// Whether a Note On is a tap on the tap tempo pad
+func isTapTempoNote(note uint8) bool {
+	return tapTempoNote != 0 && note == tapTempoNote
+}
+
+// Handle a tap: update the tempo from the recent taps and flash the pad
+func handleTap() {
+	now := time.Now()
+
+	tapMutex.Lock()
+	if n := len(tapTimes); n > 0 && now.Sub(tapTimes[n-1]) > tapResetGap {
+		tapTimes = nil
+	}
+	tapTimes = append(tapTimes, now)
+	if len(tapTimes) > tapMaxTaps {
+		tapTimes = tapTimes[1:]
+	}
+	if n := len(tapTimes); n >= 2 {
+		tapPeriod = now.Sub(tapTimes[0]) / time.Duration(n-1)
+		tapStart = now
+		log.Printf("Tap tempo: %d BPM", int(math.Round(60/tapPeriod.Seconds())))
+		select {
+		case tapChanged <- struct{}{}:
+		default:
+		}
+	}
+	tapMutex.Unlock()
+
+	flashTapPad()
+}
+
+// Light the tap tempo pad briefly
+func flashTapPad() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	pos, ok := noteToPayloadPos[tapTempoNote]
+	if !ok {
+		return
+	}
+	tapFlashes++
+	flash := tapFlashes
+	padState[tapTempoNote] = true
+	padColors[pos] = onColor(tapTempoNote)
+	queueSend()
+
+	note := tapTempoNote
+	time.AfterFunc(tapFlash, func() {
+		stateMutex.Lock()
+		defer stateMutex.Unlock()
+		if tapFlashes != flash {
+			return // Tapped again since
+		}
+		padState[note] = false
+		padColors[pos] = colorOff
+		queueSend()
+	})
+}
+
+// Forget the tapped tempo (e.g. the tap tempo pad was removed from config)
+func resetTapTempo() {
+	tapMutex.Lock()
+	defer tapMutex.Unlock()
+
+	tapTimes = nil
+	tapPeriod = 0
+	select {
+	case tapChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Whether a tapped tempo is running
+func tapTempoRunning() bool {
+	tapMutex.Lock()
+	defer tapMutex.Unlock()
+	return tapPeriod > 0
+}
+
+// Start the tap tempo beat until ctx is done: on each half beat the clock
+// indicator and the clock-synced blink flip, as on MIDI clock, unless MIDI
+// clock is being received. The returned function waits for it to stop.
+func startTapTempo(ctx context.Context) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			tapMutex.Lock()
+			period, start := tapPeriod, tapStart
+			tapMutex.Unlock()
+
+			// Idle until a tempo is tapped
+			wait := time.Duration(math.MaxInt64)
+			half := period / 2
+			var next time.Duration
+			if period > 0 {
+				next = time.Since(start)/half + 1 // Half beats since the tempo was set
+				wait = time.Until(start.Add(next * half))
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-tapChanged:
+				timer.Stop()
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			if midiClockRunning() {
+				continue
+			}
+			onBeat := next%2 == 0
+			mappingsMutex.RLock()
+			setClockIndicator(onBeat)
+			setClockBlink(!onBeat)
+			mappingsMutex.RUnlock()
+		}
+	}()
+
+	return func() {
+		<-done
+	}
+}
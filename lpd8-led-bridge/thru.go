@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// MIDI thru (-thru PORT): every message from the inputs the bridge listens
+// to is forwarded unchanged to PORT, so the bridge can sit between the LPD8
+// and a DAW. LED SysEx coming back in (the bridge's own output, e.g. through
+// a loopback port) isn't forwarded, and inputs with the thru port's name
+// aren't listened to, so thru can't loop back on itself.
+
+type midiThru struct {
+	name string // Port name, or "" for a dry run
+
+	mu   sync.Mutex // Inputs forward from their own goroutines
+	send func(msg midi.Message) error
+}
+
+// Open the thru output
+func openThru(name string) (*midiThru, error) {
+	t := &midiThru{}
+	if dryRun {
+		return t, nil
+	}
+
+	out, err := findOutPort(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.send, err = midi.SendTo(out); err != nil {
+		return nil, err
+	}
+	t.name = out.String()
+	return t, nil
+}
+
+// Wrap a handler so every message it gets is forwarded first; a nil thru
+// returns h unchanged
+func (t *midiThru) wrap(h func(midi.Message, int32)) func(midi.Message, int32) {
+	if t == nil {
+		return h
+	}
+	return func(msg midi.Message, timestampms int32) {
+		t.forward(msg)
+		h(msg, timestampms)
+	}
+}
+
+func (t *midiThru) forward(msg midi.Message) {
+	if bytes.HasPrefix(msg, sysExHeader) {
+		return // Our own LED SysEx
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if dryRun {
+		fmt.Printf("Thru %s\n", msg)
+		return
+	}
+	if err := t.send(msg); err != nil {
+		log.Printf("Error sending thru to %s: %v", t.name, err)
+	}
+}
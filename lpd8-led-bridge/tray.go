@@ -0,0 +1,134 @@
+//go:build tray
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// System tray status icon (built with -tags tray)
+//
+// The icon is a tiny picture of the pad grid in its current colors, the
+// title/tooltip show how many pads are on, and the menu offers blackout,
+// reload config and quit.
+
+const traySupported = true
+
+// How often the tray checks the pad state for changes
+const trayRefreshInterval = 250 * time.Millisecond
+
+// Run the tray until Quit is chosen or ctx is done
+// Must be called from the main goroutine
+func runTray(ctx context.Context, configPath string) {
+	onReady := func() {
+		systray.SetTitle("LPD8")
+		systray.SetTooltip("LPD8 LED Bridge")
+		mBlackout := systray.AddMenuItem("Blackout", "Turn all pads off")
+		mReload := systray.AddMenuItem("Reload config", "Reload the config file")
+		systray.AddSeparator()
+		mQuit := systray.AddMenuItem("Quit", "Stop the bridge")
+
+		go func() {
+			ticker := time.NewTicker(trayRefreshInterval)
+			defer ticker.Stop()
+
+			var shown [8]Color
+			first := true
+			for {
+				select {
+				case <-mBlackout.ClickedCh:
+					blackout()
+				case <-mReload.ClickedCh:
+					reloadConfig(activeConfigPath(configPath))
+				case <-mQuit.ClickedCh:
+					systray.Quit()
+					return
+				case <-ctx.Done():
+					systray.Quit()
+					return
+				case <-ticker.C:
+				}
+
+				colors, on := trayState()
+				if colors == shown && !first {
+					continue
+				}
+				shown, first = colors, false
+				systray.SetTitle(fmt.Sprintf("LPD8 %d/8", on))
+				systray.SetTooltip(fmt.Sprintf("LPD8 LED Bridge: %d of 8 pads on", on))
+				if icon, err := trayIcon(colors); err == nil {
+					systray.SetIcon(icon)
+				} else {
+					debugLog("Tray icon: %v", err)
+				}
+			}
+		}()
+	}
+
+	log.Println("Tray icon enabled")
+	systray.Run(onReady, nil)
+}
+
+// Current pad colors and number of pads on
+func trayState() ([8]Color, int) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	on := 0
+	for note := range noteToPayloadPos {
+		if padState[note] {
+			on++
+		}
+	}
+	return padColors, on
+}
+
+// Draw the pad grid as a 32x32 icon: top row (pads 5-8) above the bottom row
+// (pads 1-4), off pads dark grey so the icon stays visible
+func trayIcon(colors [8]Color) ([]byte, error) {
+	const size, cellW, cellH = 32, 8, 16
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for pos, c := range colors {
+		col, row := pos%4, 1 // Bottom row
+		if pos >= 4 {
+			row = 0
+		}
+		fill := color.RGBA{0x30, 0x30, 0x30, 0xff}
+		if c != colorOff {
+			fill = color.RGBA{uint8(c.R * 2), uint8(c.G * 2), uint8(c.B * 2), 0xff}
+		}
+		for y := row*cellH + 1; y < (row+1)*cellH-1; y++ {
+			for x := col*cellW + 1; x < (col+1)*cellW-1; x++ {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" {
+		return buf.Bytes(), nil
+	}
+
+	// Windows wants an .ico; a single-image ICO can hold PNG data directly
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, [3]uint16{0, 1, 1}) // Reserved, type icon, 1 image
+	ico.Write([]byte{size, size, 0, 0})                         // Width, height, palette, reserved
+	binary.Write(&ico, binary.LittleEndian, [2]uint16{1, 32})   // Planes, bits per pixel
+	binary.Write(&ico, binary.LittleEndian, [2]uint32{uint32(buf.Len()), 22})
+	ico.Write(buf.Bytes())
+	return ico.Bytes(), nil
+}
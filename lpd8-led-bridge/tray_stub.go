@@ -0,0 +1,13 @@
+//go:build !tray
+
+package main
+
+import "context"
+
+// Builds without -tags tray have no system tray (it needs GUI libraries)
+
+const traySupported = false
+
+func runTray(ctx context.Context, configPath string) {
+	<-ctx.Done()
+}
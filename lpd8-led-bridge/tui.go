@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Terminal UI (-tui): the 8 pads as colored cells laid out like the device
+// (pads 5-8 above 1-4), redrawn only when a pad or the log changes. Log
+// output is shown below the grid instead of scrolling it away.
+
+// How often the TUI checks the pad state for changes
+const tuiRefreshInterval = 50 * time.Millisecond
+
+// Log lines kept below the grid
+const tuiLogLines = 12
+
+// Check the TUI can run (stdin and stdout must be a terminal)
+func checkTUI() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("-tui needs an interactive terminal")
+	}
+	return nil
+}
+
+// Run the TUI until q or Ctrl+C is pressed or ctx is done
+func runTUI(ctx context.Context) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	logs := &tuiLog{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	// Alternate screen, hidden cursor; put both back on exit
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	quit := make(chan struct{})
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				return
+			}
+			if buf[0] == 'q' || buf[0] == 'Q' || buf[0] == 3 { // 3 = Ctrl+C in raw mode
+				close(quit)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	var shown tuiFrame
+	first := true
+	for {
+		frame := tuiFrame{logVersion: logs.version()}
+		stateMutex.Lock()
+		frame.colors = padColors
+		for note, pos := range noteToPayloadPos {
+			frame.notes[pos] = note
+			frame.on[pos] = padState[note]
+		}
+		stateMutex.Unlock()
+
+		if frame != shown || first {
+			shown, first = frame, false
+			drawTUI(os.Stdout, frame, logs.lines())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// What the TUI shows, compared to skip redraws when nothing changed
+type tuiFrame struct {
+	colors     [8]Color
+	notes      [8]uint8
+	on         [8]bool
+	logVersion int
+}
+
+func drawTUI(w io.Writer, frame tuiFrame, logs []string) {
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1b[2J") // Home, clear
+	b.WriteString("LPD8 LED Bridge - q to quit\r\n\r\n")
+
+	// Top row (positions 4-7) above the bottom row (0-3), as on the device
+	for _, row := range [][]int{{4, 5, 6, 7}, {0, 1, 2, 3}} {
+		for line := 0; line < 3; line++ {
+			for _, pos := range row {
+				b.WriteString(tuiCell(frame, pos, line))
+				b.WriteString(" ")
+			}
+			b.WriteString("\r\n")
+		}
+		b.WriteString("\r\n")
+	}
+
+	for _, line := range logs {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	w.Write(b.Bytes())
+}
+
+// One 3-line, 12-column pad cell; line 1 has the pad number, note and state
+func tuiCell(frame tuiFrame, pos, line int) string {
+	c := frame.colors[pos]
+	bg := [3]int{int(c.R) * 2, int(c.G) * 2, int(c.B) * 2} // 0-127 -> 0-254
+	if c == colorOff {
+		bg = [3]int{40, 40, 40}
+	}
+	// Dark text on bright cells
+	fg := "97"
+	if bg[0]*299+bg[1]*587+bg[2]*114 > 128000 {
+		fg = "30"
+	}
+
+	text := ""
+	if line == 1 {
+		state := "off"
+		if frame.on[pos] {
+			state = "ON"
+		}
+		text = fmt.Sprintf("%d:%d %s", pos+1, frame.notes[pos], state)
+	}
+	return fmt.Sprintf("\x1b[%s;48;2;%d;%d;%dm%-12s\x1b[0m", fg, bg[0], bg[1], bg[2], " "+text)
+}
+
+// Log output captured while the TUI is up: the last tuiLogLines lines
+type tuiLog struct {
+	mu    sync.Mutex
+	buf   []string
+	count int // Lines written so far, so the TUI sees new lines
+}
+
+func (l *tuiLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.buf = append(l.buf, line)
+		l.count++
+	}
+	if len(l.buf) > tuiLogLines {
+		l.buf = l.buf[len(l.buf)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+func (l *tuiLog) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.buf...)
+}
+
+func (l *tuiLog) version() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
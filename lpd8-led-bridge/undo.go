@@ -0,0 +1,84 @@
+package main
+
+import "log"
+
+// Undo (undo_note / undo_cc): before each pad action (press, long press,
+// scene recall, panic) the pad states and colors are pushed onto a short
+// rolling history, and the undo control pops the latest back. Unlike scenes
+// this is automatic and unnamed. Undoing doesn't push, so repeated undos
+// walk further back.
+
+// Pad actions kept for undo
+const undoDepth = 10
+
+// Set from config (0 = none)
+var (
+	undoNote uint8
+	undoCC   uint8
+)
+
+type undoSnapshot struct {
+	state  map[uint8]bool
+	colors [8]Color
+}
+
+// Oldest first (guarded by stateMutex)
+var undoHistory []undoSnapshot
+
+// Whether a Note On is the undo note
+func isUndoNote(note uint8, vel uint8) bool {
+	return undoNote != 0 && note == undoNote && vel > 0
+}
+
+// Whether a CC is the undo CC being pressed
+func isUndoCC(cc uint8, value uint8) bool {
+	return undoCC != 0 && cc == undoCC && value >= triggerCCThreshold
+}
+
+// Remember the pads as they are before a pad action
+func pushUndo() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	pushUndoLocked()
+}
+
+// Caller must hold stateMutex
+func pushUndoLocked() {
+	if undoNote == 0 && undoCC == 0 {
+		return // No way to undo, so don't bother keeping history
+	}
+	snap := undoSnapshot{state: make(map[uint8]bool, len(padState)), colors: padColors}
+	for note, on := range padState {
+		snap.state[note] = on
+	}
+	if len(undoHistory) == undoDepth {
+		undoHistory = undoHistory[1:]
+	}
+	undoHistory = append(undoHistory, snap)
+}
+
+// Put the pads back as they were before the last pad action, in one SysEx
+// (pads reserved by a feature keep showing it)
+func undo(source string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if len(undoHistory) == 0 {
+		log.Printf("Undo from %s: nothing to undo", source)
+		return
+	}
+	snap := undoHistory[len(undoHistory)-1]
+	undoHistory = undoHistory[:len(undoHistory)-1]
+
+	for note, pos := range noteToPayloadPos {
+		if reservedPads[note] {
+			continue
+		}
+		padSource[note] = ""
+		padState[note] = snap.state[note]
+		padColors[pos] = snap.colors[pos]
+	}
+	queueSend()
+
+	log.Printf("Undo from %s: %d more to undo", source, len(undoHistory))
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Validate a config, returning an error naming the first offending field
+// and value, e.g. "lpd8.top_row[2] = 200 out of range 0-127"
+func validateConfig(cfg Config) error {
+	// Every pad note in either row, for checking mapping targets
+	pads := make(map[int]bool)
+	topRow := make(map[int]bool)
+
+	// A note listed twice would give two pads the same note, so one of them
+	// could never be addressed
+	padField := make(map[int]string)
+	addPad := func(field string, note int) error {
+		if err := checkRange(field, note, 0, 127); err != nil {
+			return err
+		}
+		if other, ok := padField[note]; ok {
+			return fmt.Errorf("%s = %d duplicates %s", field, note, other)
+		}
+		padField[note] = field
+		pads[note] = true
+		return nil
+	}
+	for i, note := range cfg.LPD8.TopRow {
+		if err := addPad(fmt.Sprintf("lpd8.top_row[%d]", i), note); err != nil {
+			return err
+		}
+		topRow[note] = true
+	}
+	for i, note := range cfg.LPD8.BottomRow {
+		if err := addPad(fmt.Sprintf("lpd8.bottom_row[%d]", i), note); err != nil {
+			return err
+		}
+	}
+	for i, cc := range cfg.LPD8.Knobs {
+		if err := checkRange(fmt.Sprintf("lpd8.knobs[%d]", i), cc, 0, 127); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("lpd8.channel", cfg.LPD8.Channel, 0, 16); err != nil {
+		return err
+	}
+	if err := checkRange("lpd8.knob_channel", cfg.LPD8.KnobChannel, 0, 16); err != nil {
+		return err
+	}
+
+	checkPad := func(field string, note int) error {
+		if err := checkRange(field, note, 0, 127); err != nil {
+			return err
+		}
+		if !pads[note] {
+			return fmt.Errorf("%s = %d is not a pad in lpd8.top_row or lpd8.bottom_row", field, note)
+		}
+		return nil
+	}
+
+	for i, note := range cfg.LPD8.Momentary {
+		if err := checkPad(fmt.Sprintf("lpd8.momentary[%d]", i), note); err != nil {
+			return err
+		}
+	}
+
+	inGroup := make(map[int]int) // Pad -> index of its group
+	for g, group := range cfg.Groups {
+		for i, note := range group {
+			field := fmt.Sprintf("groups[%d][%d]", g, i)
+			if err := checkPad(field, note); err != nil {
+				return err
+			}
+			if other, ok := inGroup[note]; ok {
+				return fmt.Errorf("%s = %d is already in groups[%d]", field, note, other)
+			}
+			inGroup[note] = g
+		}
+	}
+
+	for i, note := range cfg.Blink {
+		if err := checkPad(fmt.Sprintf("blink[%d]", i), note); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("blink_ms", cfg.BlinkMs, 0, 10000); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(cfg.BlinkRates) {
+		if err := checkKey("blink_rates", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("blink_rates key %q", key), note); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("blink_rates[%q]", key), cfg.BlinkRates[key], 1, 20000); err != nil {
+			return err
+		}
+	}
+
+	// The panic note never reaches the pads, so a pad with it would be dead
+	if err := checkRange("panic_note", cfg.PanicNote, 0, 127); err != nil {
+		return err
+	}
+	if cfg.PanicNote != 0 && pads[cfg.PanicNote] {
+		return fmt.Errorf("panic_note = %d is %s, which could then never be pressed", cfg.PanicNote, padField[cfg.PanicNote])
+	}
+	if err := checkRange("panic_cc", cfg.PanicCC, 0, 127); err != nil {
+		return err
+	}
+	if err := checkRange("undo_note", cfg.UndoNote, 0, 127); err != nil {
+		return err
+	}
+	if cfg.UndoNote != 0 && pads[cfg.UndoNote] {
+		return fmt.Errorf("undo_note = %d is %s, which could then never be pressed", cfg.UndoNote, padField[cfg.UndoNote])
+	}
+	if cfg.UndoNote != 0 && cfg.UndoNote == cfg.PanicNote {
+		return fmt.Errorf("undo_note = %d is also panic_note", cfg.UndoNote)
+	}
+	if err := checkRange("undo_cc", cfg.UndoCC, 0, 127); err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(cfg.SpyRemap) {
+		if err := checkKey("spy_remap", key); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("spy_remap[%q]", key), cfg.SpyRemap[key], 0, 127); err != nil {
+			return err
+		}
+	}
+	for _, port := range sortedKeys(cfg.SpyRemapByPort) {
+		remap := cfg.SpyRemapByPort[port]
+		for _, key := range sortedKeys(remap) {
+			if err := checkKey(fmt.Sprintf("spy_remap_by_port[%q]", port), key); err != nil {
+				return err
+			}
+			if err := checkRange(fmt.Sprintf("spy_remap_by_port[%q][%q]", port, key), remap[key], 0, 127); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range sortedKeys(cfg.SpyCCRemap) {
+		if err := checkKey("spy_cc_remap", key); err != nil {
+			return err
+		}
+		if err := checkPad(fmt.Sprintf("spy_cc_remap[%q]", key), cfg.SpyCCRemap[key]); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("spy_cc_threshold", cfg.SpyCCThreshold, 0, 127); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(cfg.InitialState) {
+		if err := checkKey("initial_state", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("initial_state key %q", key), note); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.AmberToBlues) {
+		if err := checkKey("amber_to_blues", key); err != nil {
+			return err
+		}
+		amber, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("amber_to_blues key %q", key), amber); err != nil {
+			return err
+		}
+		if topRow[amber] {
+			return fmt.Errorf("amber_to_blues key %q is a pad in lpd8.top_row, not an amber pad", key)
+		}
+		for i, blue := range cfg.AmberToBlues[key] {
+			if err := checkPad(fmt.Sprintf("amber_to_blues[%q][%d]", key, i), blue); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range sortedKeys(cfg.AmberToColorCycle) {
+		if err := checkKey("amber_to_color_cycle", key); err != nil {
+			return err
+		}
+		amber, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("amber_to_color_cycle key %q", key), amber); err != nil {
+			return err
+		}
+		if topRow[amber] {
+			return fmt.Errorf("amber_to_color_cycle key %q is a pad in lpd8.top_row, not an amber pad", key)
+		}
+		if _, ok := cfg.AmberToBlues[key]; ok {
+			return fmt.Errorf("amber_to_color_cycle key %q is also an amber_to_blues key; an amber can only do one", key)
+		}
+		if len(cfg.AmberToColorCycle[key]) == 0 {
+			return fmt.Errorf("amber_to_color_cycle[%q] has no colors", key)
+		}
+	}
+	for _, key := range sortedKeys(cfg.AmberToBluesMode) {
+		if _, ok := cfg.AmberToBlues[key]; !ok {
+			return fmt.Errorf("amber_to_blues_mode key %q is not an amber_to_blues key", key)
+		}
+		switch cfg.AmberToBluesMode[key] {
+		case "", amberModeOpposite, amberModeSame:
+		default:
+			return fmt.Errorf("amber_to_blues_mode[%q] = %q must be %q or %q", key, cfg.AmberToBluesMode[key], amberModeOpposite, amberModeSame)
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobToToggle) {
+		if err := checkKey("knob_to_toggle", key); err != nil {
+			return err
+		}
+		if err := checkPad(fmt.Sprintf("knob_to_toggle[%q]", key), cfg.KnobToToggle[key]); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobToBlue) {
+		if err := checkKey("knob_to_blue", key); err != nil {
+			return err
+		}
+		if err := checkPad(fmt.Sprintf("knob_to_blue[%q]", key), cfg.KnobToBlue[key]); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobToChannel) {
+		if err := checkKey("knob_to_channel", key); err != nil {
+			return err
+		}
+		target := cfg.KnobToChannel[key]
+		if err := checkPad(fmt.Sprintf("knob_to_channel[%q].note", key), target.Note); err != nil {
+			return err
+		}
+		switch target.Channel {
+		case "r", "g", "b":
+		default:
+			return fmt.Errorf("knob_to_channel[%q].channel = %q must be \"r\", \"g\" or \"b\"", key, target.Channel)
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobMode) {
+		if err := checkKey("knob_mode", key); err != nil {
+			return err
+		}
+		switch cfg.KnobMode[key] {
+		case "", knobModeBrightness, knobModeHue:
+		default:
+			return fmt.Errorf("knob_mode[%q] = %q must be %q or %q", key, cfg.KnobMode[key], knobModeBrightness, knobModeHue)
+		}
+	}
+	for i, cc := range cfg.KnobMomentary {
+		if err := checkRange(fmt.Sprintf("knob_momentary[%d]", i), cc, 0, 127); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("knob_off_threshold", cfg.KnobOffThreshold, 0, 127); err != nil {
+		return err
+	}
+	if err := checkRange("knob_on_threshold", cfg.KnobOnThreshold, 0, 127); err != nil {
+		return err
+	}
+	if cfg.KnobSmoothing < 0 || cfg.KnobSmoothing >= 1 {
+		return fmt.Errorf("knob_smoothing = %g out of range 0-0.99 (0 = off)", cfg.KnobSmoothing)
+	}
+	if off, on := cmp.Or(cfg.KnobOffThreshold, 2), cmp.Or(cfg.KnobOnThreshold, 3); on < off {
+		return fmt.Errorf("knob_on_threshold = %d is below knob_off_threshold = %d", on, off)
+	}
+
+	switch cfg.KnobVsPadPriority {
+	case "", sourceKnob, sourcePad:
+	default:
+		return fmt.Errorf("knob_vs_pad_priority = %q must be \"\", %q or %q", cfg.KnobVsPadPriority, sourceKnob, sourcePad)
+	}
+	for _, key := range sortedKeys(cfg.KnobComet) {
+		if err := checkKey("knob_comet", key); err != nil {
+			return err
+		}
+		comet := cfg.KnobComet[key]
+		if comet.Row != "top" && comet.Row != "bottom" {
+			return fmt.Errorf("knob_comet[%q].row = %q must be \"top\" or \"bottom\"", key, comet.Row)
+		}
+		if err := checkRange(fmt.Sprintf("knob_comet[%q].tail", key), comet.Tail, 0, 3); err != nil {
+			return err
+		}
+	}
+	if err := checkRange("press_merge_ms", cfg.PressMergeMs, 0, 60000); err != nil {
+		return err
+	}
+	if err := checkRange("loop_max_presses", cfg.LoopMaxPresses, 0, 1000); err != nil {
+		return err
+	}
+	if err := checkRange("loop_window_ms", cfg.LoopWindowMs, 0, 60000); err != nil {
+		return err
+	}
+	if err := checkRange("output_interval_ms", cfg.OutputIntervalMs, 0, 1000); err != nil {
+		return err
+	}
+	if err := checkRange("fade_ms", cfg.FadeMs, 0, 10000); err != nil {
+		return err
+	}
+	if err := checkRange("aftertouch_scene", cfg.AftertouchScene, 0, numScenes); err != nil {
+		return err
+	}
+	if err := checkRange("aftertouch_scene_threshold", cfg.AftertouchSceneThreshold, 0, 127); err != nil {
+		return err
+	}
+	if err := checkRange("broadcast_ms", cfg.BroadcastMs, 0, 10000); err != nil {
+		return err
+	}
+	if err := checkRange("auto_save_sec", cfg.AutoSaveSec, 0, 86400); err != nil {
+		return err
+	}
+	if err := checkRange("auto_off_ms", cfg.AutoOffMs, 0, 86400000); err != nil {
+		return err
+	}
+	if err := checkRange("brightness", cfg.Brightness, 0, 127); err != nil {
+		return err
+	}
+	if err := checkRange("brightness_cc", cfg.BrightnessCC, 0, 127); err != nil {
+		return err
+	}
+	if cfg.KnobGamma != 0 && (cfg.KnobGamma < 0.1 || cfg.KnobGamma > 5) {
+		return fmt.Errorf("knob_gamma = %g out of range 0.1-5 (0 = 2.2)", cfg.KnobGamma)
+	}
+	for _, f := range []struct {
+		field string
+		value int
+	}{
+		{"knob_in_min", cfg.KnobInMin},
+		{"knob_in_max", cfg.KnobInMax},
+		{"knob_out_min", cfg.KnobOutMin},
+		{"knob_out_max", cfg.KnobOutMax},
+	} {
+		if err := checkRange(f.field, f.value, 0, 127); err != nil {
+			return err
+		}
+	}
+	in, out := knobRanges(cfg)
+	if in[0] >= in[1] {
+		return fmt.Errorf("knob_in_min = %d must be below knob_in_max = %d", in[0], in[1])
+	}
+	if out[0] >= out[1] {
+		return fmt.Errorf("knob_out_min = %d must be below knob_out_max = %d", out[0], out[1])
+	}
+	for _, key := range sortedKeys(cfg.KnobColorTemp) {
+		if err := checkKey("knob_color_temp", key); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("knob_color_temp[%q]", key), cfg.KnobColorTemp[key], 0, 127); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.KnobFadeTime) {
+		if err := checkKey("knob_fade_time", key); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("knob_fade_time[%q]", key), cfg.KnobFadeTime[key], 0, 10000); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.PadCooldowns) {
+		if err := checkKey("pad_cooldowns", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("pad_cooldowns key %q", key), note); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("pad_cooldowns[%q]", key), cfg.PadCooldowns[key], 0, 60000); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.PadColors) {
+		if err := checkKey("pad_colors", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("pad_colors key %q", key), note); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.SplitPads) {
+		if err := checkKey("split_pads", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("split_pads key %q", key), note); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.ChannelColors) {
+		ch, err := strconv.Atoi(key)
+		if err != nil || ch < 1 || ch > 16 {
+			return fmt.Errorf("channel_colors key %q must be a MIDI channel 1-16", key)
+		}
+	}
+
+	// Feature pads (0 = disabled)
+	for _, f := range []struct {
+		field string
+		note  int
+	}{
+		{"clock_indicator_note", cfg.ClockIndicatorNote},
+		{"record_note", cfg.RecordNote},
+		{"play_note", cfg.PlayNote},
+		{"tap_tempo_note", cfg.TapTempoNote},
+		{"polarity_toggle_note", cfg.PolarityToggleNote},
+		{"palette_cycle_note", cfg.PaletteCycleNote},
+	} {
+		if err := checkRange(f.field, f.note, 0, 127); err != nil {
+			return err
+		}
+	}
+
+	// Scene controls: one entry per slot, 0 = none
+	sceneControl := make(map[int]string) // Scene pad -> its field
+	for _, f := range []struct {
+		field    string
+		controls []int
+		pad      bool
+	}{
+		{"scene_store", cfg.SceneStore, true},
+		{"scene_recall", cfg.SceneRecall, true},
+		{"scene_store_cc", cfg.SceneStoreCC, false},
+		{"scene_recall_cc", cfg.SceneRecallCC, false},
+	} {
+		if len(f.controls) > numScenes {
+			return fmt.Errorf("%s has %d entries, at most %d scenes are supported", f.field, len(f.controls), numScenes)
+		}
+		for i, n := range f.controls {
+			field := fmt.Sprintf("%s[%d]", f.field, i)
+			if !f.pad || n == 0 {
+				if err := checkRange(field, n, 0, 127); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := checkPad(field, n); err != nil {
+				return err
+			}
+			if other, ok := sceneControl[n]; ok {
+				return fmt.Errorf("%s = %d is already %s", field, n, other)
+			}
+			sceneControl[n] = field
+		}
+	}
+
+	for _, key := range sortedKeys(cfg.CCFeedback) {
+		if err := checkKey("cc_feedback", key); err != nil {
+			return err
+		}
+		if err := checkPad(fmt.Sprintf("cc_feedback[%q]", key), cfg.CCFeedback[key]); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.KeyMap) {
+		if err := checkKey("key_map", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("key_map key %q", key), note); err != nil {
+			return err
+		}
+		if _, err := parseKeyCombo(cfg.KeyMap[key]); err != nil {
+			return fmt.Errorf("key_map[%q] = %q: %v", key, cfg.KeyMap[key], err)
+		}
+	}
+	for _, key := range sortedKeys(cfg.PadToProgramChange) {
+		if err := checkKey("pad_to_program_change", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("pad_to_program_change key %q", key), note); err != nil {
+			return err
+		}
+		pc := cfg.PadToProgramChange[key]
+		if pc.Port == "" {
+			return fmt.Errorf("pad_to_program_change[%q].port is empty", key)
+		}
+		if err := checkRange(fmt.Sprintf("pad_to_program_change[%q].program", key), pc.Program, 0, 127); err != nil {
+			return err
+		}
+		if err := checkRange(fmt.Sprintf("pad_to_program_change[%q].channel", key), pc.Channel, 1, 16); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.LongPress) {
+		if err := checkKey("long_press", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("long_press key %q", key), note); err != nil {
+			return err
+		}
+		if slices.Contains(cfg.LPD8.Momentary, note) {
+			return fmt.Errorf("long_press key %q is a momentary pad, which acts while held", key)
+		}
+		if _, err := parseLongPressAction(cfg.LongPress[key]); err != nil {
+			return fmt.Errorf("long_press[%q] = %q: %v", key, cfg.LongPress[key], err)
+		}
+	}
+	if err := checkRange("long_press_ms", cfg.LongPressMs, 0, 10000); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(cfg.DoubleTap) {
+		if err := checkKey("double_tap", key); err != nil {
+			return err
+		}
+		note, _ := strconv.Atoi(key)
+		if err := checkPad(fmt.Sprintf("double_tap key %q", key), note); err != nil {
+			return err
+		}
+		if slices.Contains(cfg.LPD8.Momentary, note) {
+			return fmt.Errorf("double_tap key %q is a momentary pad, which acts while held", key)
+		}
+		if _, ok := cfg.LongPress[key]; ok {
+			return fmt.Errorf("double_tap key %q is also a long_press key; a pad can only have one", key)
+		}
+		if _, err := parseDoubleTapAction(cfg.DoubleTap[key]); err != nil {
+			return fmt.Errorf("double_tap[%q] = %q: %v", key, cfg.DoubleTap[key], err)
+		}
+	}
+	if err := checkRange("double_tap_ms", cfg.DoubleTapMs, 0, 2000); err != nil {
+		return err
+	}
+	if err := checkRange("cc_feedback_channel", cfg.CCFeedbackChannel, 0, 16); err != nil {
+		return err
+	}
+	if err := checkRange("cc_feedback_threshold", cfg.CCFeedbackThreshold, 0, 127); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkRange(field string, value, lo, hi int) error {
+	if value < lo || value > hi {
+		return fmt.Errorf("%s = %d out of range %d-%d", field, value, lo, hi)
+	}
+	return nil
+}
+
+// Check a map key is a note/CC number in 0-127
+func checkKey(field, key string) error {
+	n, err := strconv.Atoi(key)
+	if err != nil {
+		return fmt.Errorf("%s key %q is not a number", field, key)
+	}
+	return checkRange(fmt.Sprintf("%s key %q", field, key), n, 0, 127)
+}
+
+// Map keys in sorted order so errors are reported deterministically
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket state stream for browser dashboards (GET /ws on the -http
+// server): a full state message on connect, then one every time a frame
+// goes out to the LPD8, so the page shows exactly what the device does.
+// Messages are the GET /state JSON, with the colors as rendered. Only the
+// server side of RFC 6455 needed for pushing text messages is implemented;
+// anything the browser sends other than ping and close is ignored.
+//
+// With broadcast_ms, each client gets at most one message per interval:
+// states that arrive in between replace the one waiting, so a client (slow
+// or not) skips intermediate states but always ends on the latest.
+
+const (
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsWriteTimeout = 5 * time.Second
+	wsMaxFrame     = 4096 // Largest client frame accepted
+)
+
+// Minimum time between state messages to each client, set from config
+// (0 = one per frame); guarded by stateMutex
+var broadcastInterval time.Duration
+
+// WebSocket opcodes
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+type wsClient struct {
+	conn    net.Conn
+	pending []byte        // Latest state not yet sent, nil if none (guarded by stateHub.mu)
+	notify  chan struct{} // Signalled when pending is set
+	done    chan struct{} // Closed when the client is dropped
+	writeMu sync.Mutex    // The write loop and pong replies share conn
+}
+
+// Connected clients and the last state sent, so new clients start in sync
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+	last    *stateSnapshot
+}
+
+var stateHub = &wsHub{clients: make(map[*wsClient]bool)}
+
+// Push a state to every client; called from flushFrame after each frame
+// is sent. Never blocks: a client still writing an earlier state gets
+// this one in its place.
+func (h *wsHub) broadcast(snap stateSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.last = &snap
+	if len(h.clients) == 0 {
+		return
+	}
+	msg, err := json.Marshal(snap)
+	if err != nil {
+		debugLog("WebSocket: encoding state failed: %v", err)
+		return
+	}
+	for c := range h.clients {
+		c.queueLocked(msg)
+	}
+}
+
+// Make msg the client's next message, replacing any still waiting
+// Caller must hold stateHub.mu
+func (c *wsClient) queueLocked(msg []byte) {
+	c.pending = msg
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Take the client's waiting message, nil if there is none
+func (h *wsHub) take(c *wsClient) []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg := c.pending
+	c.pending = nil
+	return msg
+}
+
+// Register a client, queueing the current state as its first message
+func (h *wsHub) add(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snap := h.last
+	if snap == nil {
+		s := snapshotState() // Nothing sent to the LPD8 yet
+		snap = &s
+	}
+	if msg, err := json.Marshal(snap); err == nil {
+		c.queueLocked(msg)
+	}
+	h.clients[c] = true
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[c] {
+		h.dropLocked(c)
+	}
+}
+
+// Unregister a client and close it, ending its write loop; caller must hold
+// h.mu and the client must still be registered
+func (h *wsHub) dropLocked(c *wsClient) {
+	delete(h.clients, c)
+	close(c.done)
+	c.conn.Close()
+}
+
+// Disconnect every client (on shutdown; hijacked connections aren't
+// closed by the HTTP server)
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		h.dropLocked(c)
+	}
+}
+
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		debugLog("WebSocket: hijack failed: %v", err)
+		return
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(sum[:])+"\r\n\r\n")
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	c := &wsClient{conn: conn, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	stateHub.add(c)
+	debugLog("WebSocket: %s connected", conn.RemoteAddr())
+
+	go wsWriteLoop(c)
+	wsReadLoop(c, rw.Reader)
+	stateHub.remove(c)
+	debugLog("WebSocket: %s disconnected", conn.RemoteAddr())
+}
+
+// Whether a comma-separated header contains token (case-insensitive)
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Send the latest state whenever there's a new one, at most once per
+// broadcastInterval, until the client is dropped; a state the client
+// already has isn't sent again. A failed write closes the connection,
+// which ends the read loop.
+func wsWriteLoop(c *wsClient) {
+	var sent []byte
+	var sentAt time.Time
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+
+		stateMutex.Lock()
+		interval := broadcastInterval
+		stateMutex.Unlock()
+		if wait := interval - time.Since(sentAt); wait > 0 {
+			// States arriving meanwhile replace the pending one
+			select {
+			case <-time.After(wait):
+			case <-c.done:
+				return
+			}
+		}
+
+		msg := stateHub.take(c)
+		if msg == nil || bytes.Equal(msg, sent) {
+			continue
+		}
+		if err := c.writeFrame(wsText, msg); err != nil {
+			c.conn.Close()
+			return
+		}
+		sent, sentAt = msg, time.Now()
+	}
+}
+
+// Read client frames until close or error, answering pings; frames are
+// read whole, so a fragmented message is just several ignored frames
+func wsReadLoop(c *wsClient, r *bufio.Reader) {
+	for {
+		opcode, payload, err := wsReadFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				debugLog("WebSocket: %s: %v", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		switch opcode {
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return
+		case wsPing:
+			// Written directly; pending only carries state messages
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Read one client frame, unmasking its payload
+func wsReadFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxFrame {
+		return 0, nil, errors.New("client frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// Write one unfragmented, unmasked server frame
+func (c *wsClient) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode} // FIN
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}